@@ -0,0 +1,66 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"secure-transfer/internal/audit"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log of received items",
+	}
+
+	auditVerifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Check that no audit log entry was modified, removed or reordered",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(auditLogFile())
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			count, last, err := audit.Verify(f)
+			if err != nil {
+				return fmt.Errorf("audit log %s failed verification after %d entries: %w", auditLogFile(), count, err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %d entries, chain intact\n", auditLogFile(), count)
+			if last != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "Last entry hash: %s\n", last)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	auditVerifyCmd.Flags().StringVar(&auditLog, "audit-log", "", "Audit log to verify (default <config-dir>/audit.log)")
+	auditCmd.AddCommand(auditVerifyCmd)
+}
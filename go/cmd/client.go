@@ -22,9 +22,15 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/addressbook"
 	"secure-transfer/internal/transfer"
 
 	"github.com/spf13/cobra"
@@ -34,28 +40,177 @@ var (
 	clientCmd = &cobra.Command{
 		Use:   "client",
 		Short: "Send a file or message",
+		Long: `Send a file or message to the receiver at --ip, or to every
+receiver listed in --to.
+
+Receivers are addresses or names from the address book (see 'peers'). A
+peer is reached at its recorded address and must prove the identity
+recorded for it; a group stands for all of its members.
+
+Other receivers are trusted on first use: the identity each address
+proves is pinned in <config-dir>/known_receivers and a different one
+is refused later. Only a fingerprint recorded with 'peers add' protects
+the first transfer to a receiver from impersonation.
+
+With --to the receivers are sent to concurrently, at most --parallel at
+a time, and each one's outcome is printed. The exit status is 0 when all
+succeed, 9 when only some do, and otherwise the status the failures have
+in common, or 1 when they differ.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			key, err := crypto.GetAESKey(logger)
+			if len(to) > 0 && commandLineFlags["ip"] {
+				return &usageError{errors.New("--ip and --to cannot be combined")}
+			}
+			if parallel < 1 {
+				return &usageError{fmt.Errorf("--parallel must be at least 1, got %d", parallel)}
+			}
+			targets := to
+			if len(targets) == 0 {
+				targets = []string{ip}
+			}
+			recipients, err := resolveRecipients(targets, port)
 			if err != nil {
-				return fmt.Errorf("error with encryption key: %w", err)
+				return err
+			}
+			if len(to) == 0 && len(recipients) > 1 {
+				return &usageError{fmt.Errorf("%q is a group, send to it with --to", ip)}
 			}
 
-			if cmd.Flags().Changed("message") {
-				return transfer.SendMessage(ip, port, file, message, key, logger)
+			keys, err := loadKeys()
+			if err != nil {
+				return err
 			}
-			return transfer.SendFile(ip, port, file, key, logger)
+
+			opts, err := transferOptions(keys)
+			if err != nil {
+				return err
+			}
+			opts.Retry = retry
+
+			if len(to) > 0 {
+				return sendToMany(cmd, recipients, keys.Current, opts)
+			}
+			return send(cmd, recipients[0], keys.Current, opts)
 		},
 	}
 
 	// Client-specific flags
-	ip      string
-	file    string
-	message string
+	ip          string
+	to          []string
+	parallel    int
+	file        string
+	message     string
+	compression string
+	retry       transfer.Retry
 )
 
 func init() {
-	clientCmd.Flags().StringVarP(&ip, "ip", "i", "localhost", "Receiver IP address")
+	clientCmd.Flags().StringVarP(&ip, "ip", "i", "localhost", "Receiver address or peer name (or set ip in a config profile)")
+	clientCmd.Flags().StringSliceVar(&to, "to", nil, "Send to each of these receivers, as host, host:port, peer or group names, instead of --ip")
+	clientCmd.Flags().IntVar(&parallel, "parallel", 4, "Number of --to receivers sent to at once")
 	clientCmd.Flags().StringVarP(&file, "file", "f", "", "File to send")
 	clientCmd.Flags().StringVarP(&message, "message", "m", "", "Message to send instead of a file")
-	clientCmd.MarkFlagRequired("ip")
+	clientCmd.Flags().StringVar(&compression, "compress", "auto", "Compression to apply before encryption (auto, zstd, gzip, none)")
+	clientCmd.Flags().DurationVar(&retry.ConnectTimeout, "connect-timeout", 10*time.Second, "Time allowed for each connection attempt")
+	clientCmd.Flags().IntVar(&retry.Retries, "retries", 3, "Connection attempts to make after the first one fails")
+	clientCmd.Flags().DurationVar(&retry.Backoff, "retry-backoff", 500*time.Millisecond, "Delay before the first retry, doubled for each further retry")
+	clientCmd.Flags().DurationVar(&retry.MaxBackoff, "retry-max-backoff", 30*time.Second, "Longest delay between retries")
+	clientCmd.Flags().BoolVar(&retry.Wait, "wait", false, "Keep retrying until the receiver is reachable, ignoring --retries")
+}
+
+// recipient is a receiver to send to
+type recipient struct {
+	host string
+	port int
+
+	// fingerprint, when set, is the identity the receiver must prove
+	fingerprint string
+}
+
+func (r recipient) address() string {
+	return net.JoinHostPort(r.host, strconv.Itoa(r.port))
+}
+
+// resolveRecipients turns receivers given as addresses or address book
+// names into recipients, using defaultPort where an address has none
+// and dropping duplicates
+func resolveRecipients(targets []string, defaultPort int) ([]recipient, error) {
+	book, err := addressbook.Load(addressBookFile())
+	if err != nil {
+		return nil, err
+	}
+	var recipients []recipient
+	add := func(address, fingerprint string) error {
+		host, port, err := addressbook.SplitAddress(address, defaultPort)
+		if err != nil {
+			return &usageError{err}
+		}
+		r := recipient{host: host, port: port, fingerprint: fingerprint}
+		if !slices.ContainsFunc(recipients, func(other recipient) bool { return other.address() == r.address() }) {
+			recipients = append(recipients, r)
+		}
+		return nil
+	}
+
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		peers, ok := book.Resolve(target)
+		if !ok {
+			if err := add(target, ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, peer := range peers {
+			if err := add(peer.Address, peer.Fingerprint); err != nil {
+				return nil, fmt.Errorf("peer %s: %w", peer.Name, err)
+			}
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, &usageError{errors.New("no receivers given")}
+	}
+	return recipients, nil
+}
+
+// send sends the message or file to one recipient
+func send(cmd *cobra.Command, r recipient, key []byte, opts transfer.Options) error {
+	opts.ReceiverFingerprint = r.fingerprint
+	if cmd.Flags().Changed("message") {
+		return transfer.SendMessage(r.host, r.port, file, message, key, opts, logger)
+	}
+	return transfer.SendFile(r.host, r.port, file, key, opts, logger)
+}
+
+// sendToMany sends the message or file to every recipient and prints how
+// each delivery went
+func sendToMany(cmd *cobra.Command, recipients []recipient, key []byte, opts transfer.Options) error {
+	deliveries, err := deliver(recipients, parallel, func(r recipient) error {
+		return send(cmd, r, key, opts)
+	})
+
+	out := cmd.OutOrStdout()
+	for _, d := range deliveries {
+		if d.Err != nil {
+			fmt.Fprintf(out, "FAILED  %s: %v\n", d.Address, d.Err)
+		} else {
+			fmt.Fprintf(out, "OK      %s (%s)\n", d.Address, d.Duration.Round(time.Millisecond))
+		}
+	}
+	return err
+}
+
+// deliver runs send for every recipient, at most parallelism at a time
+func deliver(recipients []recipient, parallelism int, send func(recipient) error) ([]transfer.Delivery, error) {
+	addresses := make([]string, len(recipients))
+	byAddress := make(map[string]recipient, len(recipients))
+	for i, r := range recipients {
+		addresses[i] = r.address()
+		byAddress[addresses[i]] = r
+	}
+	return transfer.Fanout(addresses, parallelism, func(address string) error {
+		return send(byAddress[address])
+	})
 }
@@ -0,0 +1,171 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"secure-transfer/internal/config"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration file",
+		// Skip applying the config so a broken file can still be inspected
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return setupLogger()
+		},
+	}
+
+	configShowCmd = &cobra.Command{
+		Use:   "show",
+		Short: "Print the effective settings after merging config, profile, environment and flags",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			settings, f, err := loadSettings()
+			if err != nil {
+				return err
+			}
+			cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+				// Flags without a matching setting are rejected by Set and skipped
+				if flag.Changed {
+					_ = settings.Set(configKey(flag.Name), flagText(flag))
+				}
+			})
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "# config: %s\n", f.Path)
+			if name := activeProfile(); name != "" {
+				fmt.Fprintf(out, "# profile: %s\n", name)
+			}
+			if names := f.ProfileNames(); len(names) > 0 {
+				fmt.Fprintf(out, "# available profiles: %s\n", strings.Join(names, ", "))
+			}
+			return toml.NewEncoder(out).Encode(settings)
+		},
+	}
+
+	configValidateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config file and environment overrides for errors",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := config.Load(configPath())
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(f.Path); errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(cmd.OutOrStdout(), "No config file at %s, using built-in defaults\n", f.Path)
+			}
+			if err := f.Validate(); err != nil {
+				return fmt.Errorf("invalid config %s:\n%w", f.Path, err)
+			}
+			if _, _, err := loadSettings(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: OK (%d profiles)\n", f.Path, len(f.Profiles))
+			return nil
+		},
+	}
+)
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+}
+
+// configPath returns the config file in use
+func configPath() string {
+	if configFile != "" {
+		return configFile
+	}
+	if path := os.Getenv("TRANSFER_CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(configDir, "config.toml")
+}
+
+// activeProfile returns the profile selected by flag or environment
+func activeProfile() string {
+	if profile != "" {
+		return profile
+	}
+	return os.Getenv("TRANSFER_PROFILE")
+}
+
+// loadSettings merges the config file defaults, the active profile and the
+// environment, in increasing order of precedence
+func loadSettings() (config.Settings, *config.File, error) {
+	f, err := config.Load(configPath())
+	if err != nil {
+		return config.Settings{}, nil, err
+	}
+	settings, err := f.Profile(activeProfile())
+	if err != nil {
+		return settings, f, err
+	}
+	if err := settings.ApplyEnv(os.Getenv); err != nil {
+		return settings, f, err
+	}
+	settings.ExpandPaths()
+	if err := settings.Validate(); err != nil {
+		return settings, f, fmt.Errorf("invalid config %s: %w", f.Path, err)
+	}
+	return settings, f, nil
+}
+
+// applySettings uses settings as the value of every flag of cmd that was
+// not given on the command line
+func applySettings(cmd *cobra.Command, settings config.Settings) error {
+	for _, key := range config.Keys() {
+		value := settings.Get(key)
+		flag := cmd.Flags().Lookup(config.FlagName(key))
+		if value == "" || flag == nil || flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(flag.Name, value); err != nil {
+			return fmt.Errorf("config setting %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// configKey returns the setting behind a flag name
+func configKey(flagName string) string {
+	return strings.ReplaceAll(flagName, "-", "_")
+}
+
+// flagText returns a flag's value in the form Settings.Set parses
+func flagText(flag *pflag.Flag) string {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		return strings.Join(slice.GetSlice(), ",")
+	}
+	return flag.Value.String()
+}
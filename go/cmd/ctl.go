@@ -0,0 +1,134 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"secure-transfer/internal/control"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	ctlCmd = &cobra.Command{
+		Use:   "ctl <" + strings.Join(control.Commands, "|") + "> [id]",
+		Short: "Query or steer a running daemon through its control socket",
+		Long: `Query or steer a running daemon through its control socket.
+
+  status       show the daemon's address, uptime and counters
+  pause        stop copying received content to the clipboard
+  resume       copy received content to the clipboard again
+  connections  list the connections being handled
+  reload       re-read the config file and key
+  shutdown     stop the daemon
+  pending      list received items awaiting approval
+  accept <id>  save or copy a held item
+  reject <id>  discard a held item`,
+		Args:      cobra.RangeArgs(1, 2),
+		ValidArgs: control.Commands,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return setupLogger()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := control.Request{Command: args[0]}
+			switch req.Command {
+			case control.CommandAccept, control.CommandReject:
+				if len(args) != 2 {
+					return &usageError{fmt.Errorf("%s needs the ID of a pending item", req.Command)}
+				}
+				id, err := strconv.ParseUint(args[1], 10, 64)
+				if err != nil {
+					return &usageError{fmt.Errorf("invalid item ID %q", args[1])}
+				}
+				req.ID = id
+			default:
+				if len(args) != 1 {
+					return &usageError{fmt.Errorf("%s takes no arguments", req.Command)}
+				}
+			}
+
+			resp, err := control.Call(controlSocket, req)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if ctlJSON {
+				encoder := json.NewEncoder(out)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(resp)
+			}
+
+			switch {
+			case resp.Status != nil:
+				status := resp.Status
+				clipboard := "active"
+				if status.ClipboardPaused {
+					clipboard = "paused"
+				}
+				fmt.Fprintf(out, "PID:          %d\n", status.PID)
+				fmt.Fprintf(out, "Address:      %s\n", status.Address)
+				if status.Config != "" {
+					fmt.Fprintf(out, "Config:       %s\n", status.Config)
+				}
+				fmt.Fprintf(out, "Uptime:       %s\n", time.Since(status.Started).Round(time.Second))
+				fmt.Fprintf(out, "Clipboard:    %s\n", clipboard)
+				fmt.Fprintf(out, "Connections:  %d\n", status.Connections)
+				fmt.Fprintf(out, "Received:     %d\n", status.Received)
+			case args[0] == control.CommandConnections:
+				if len(resp.Connections) == 0 {
+					fmt.Fprintln(out, "No open connections")
+				}
+				for _, c := range resp.Connections {
+					identity := c.Identity
+					if identity == "" {
+						identity = "(handshake)"
+					}
+					fmt.Fprintf(out, "%d\t%s\t%s\t%s\n", c.ID, c.Peer, identity, time.Since(c.Since).Round(time.Millisecond))
+				}
+			case args[0] == control.CommandPending:
+				if len(resp.Pending) == 0 {
+					fmt.Fprintln(out, "No items awaiting approval")
+				}
+				for _, item := range resp.Pending {
+					fmt.Fprintf(out, "%d\t%s\t%s\t%d bytes\t%s\n", item.ID, item.Type, item.Sender(), item.Size, item.Preview)
+				}
+			default:
+				fmt.Fprintln(out, "OK")
+			}
+			return nil
+		},
+	}
+
+	// Ctl-specific flags
+	ctlJSON bool
+)
+
+func init() {
+	ctlCmd.Flags().StringVar(&controlSocket, "control-socket", control.DefaultPath(), "Control socket of the daemon")
+	ctlCmd.Flags().BoolVar(&ctlJSON, "json", false, "Print the daemon's response as JSON")
+}
@@ -0,0 +1,378 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"secure-transfer/internal/approval"
+	"secure-transfer/internal/config"
+	"secure-transfer/internal/control"
+	"secure-transfer/internal/daemon"
+	"secure-transfer/internal/notify"
+	"secure-transfer/internal/transfer"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	daemonCmd = &cobra.Command{
+		Use:   "daemon",
+		Short: "Run the echo server as a background service",
+		Long: `Run the echo server as a background service.
+
+The daemon serves on a socket passed by systemd socket activation when
+there is one, and listens on --bind and --port otherwise. It reports
+readiness to systemd, can record its PID and shuts down cleanly on
+SIGTERM or SIGINT.
+
+A control socket lets 'secure-transfer ctl' query and steer the daemon.
+Reloading, through the control socket or SIGHUP, re-reads the config file
+and key and applies the keys, --allow, --deny, --clipboard, --auto-accept,
+--notify, --max-connections, --rate, --burst and --max-size to new
+connections; other settings need a restart.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if pidFile != "" {
+				remove, err := daemon.WritePIDFile(pidFile)
+				if err != nil {
+					return err
+				}
+				defer remove()
+			}
+
+			key, opts, err := echoSetup()
+			if err != nil {
+				return err
+			}
+			listener, err := daemonListener(opts)
+			if err != nil {
+				return err
+			}
+			defer listener.Close()
+
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+			defer stop()
+			context.AfterFunc(ctx, func() {
+				logger.Info("Shutting down")
+				daemon.Notify("STOPPING=1")
+				listener.Close()
+			})
+
+			reload := func() error { return reloadDaemon(cmd, key, opts) }
+			if !noControl {
+				closeControl, err := startControl(listener.Addr().String(), opts.State, approvalQueue(opts), reload, stop)
+				if err != nil {
+					return err
+				}
+				defer closeControl()
+			}
+			go reloadOnHangup(ctx, reload)
+
+			if notified, err := daemon.Notify("READY=1"); err != nil {
+				logger.Warn("Could not notify service manager", "error", err)
+			} else if notified {
+				logger.Debug("Notified service manager of readiness")
+			}
+			return transfer.ServeEcho(listener, key, opts, logger)
+		},
+	}
+
+	installServiceCmd = &cobra.Command{
+		Use:   "install-service",
+		Short: "Write a systemd user unit running the daemon with the given flags",
+		Long: `Write a systemd user unit running the daemon with the given flags.
+
+Flags given to install-service are passed on to the daemon, along with the
+config directory, so the service runs with the current configuration.
+With --socket a socket unit is written too and systemd listens on behalf
+of the daemon, starting it on the first connection.`,
+		Args: cobra.NoArgs,
+		// The config file is read by the service, not baked into the unit
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return setupLogger()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			unit, err := serviceUnit(cmd)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if printUnits {
+				fmt.Fprintf(out, "# %s.service\n%s", daemon.ServiceName, unit.Service())
+				if socket := unit.Socket(); socket != "" {
+					fmt.Fprintf(out, "\n# %s.socket\n%s", daemon.ServiceName, socket)
+				}
+				return nil
+			}
+
+			dir, err := daemon.UnitDir()
+			if err != nil {
+				return err
+			}
+			written, err := unit.Install(dir)
+			if err != nil {
+				return err
+			}
+			for _, path := range written {
+				fmt.Fprintf(out, "Wrote %s\n", path)
+			}
+			start := daemon.ServiceName + ".service"
+			if unit.ListenStream != "" {
+				start = daemon.ServiceName + ".socket"
+			}
+			fmt.Fprintf(out, "\nEnable it with:\n  systemctl --user daemon-reload\n  systemctl --user enable --now %s\n", start)
+			fmt.Fprintf(out, "\nFor clipboard access, make the graphical session visible to user services:\n  systemctl --user import-environment DISPLAY WAYLAND_DISPLAY\n")
+			return nil
+		},
+	}
+
+	// Daemon-specific flags
+	pidFile       string
+	controlSocket string
+	noControl     bool
+	socketUnit    bool
+	printUnits    bool
+)
+
+// installOnlyFlags configure install-service itself and are not passed on
+var installOnlyFlags = map[string]bool{"socket": true, "print": true, "config-dir": true}
+
+// pathFlags name files, made absolute since services start in another directory
+var pathFlags = map[string]bool{"config": true, "key-file": true, "log-file": true, "audit-log": true, "pid-file": true}
+
+func init() {
+	addDaemonFlags(daemonCmd)
+	addDaemonFlags(installServiceCmd)
+	installServiceCmd.Flags().BoolVar(&socketUnit, "socket", false, "Also write a socket unit so systemd listens on --bind and --port")
+	installServiceCmd.Flags().BoolVar(&printUnits, "print", false, "Print the units instead of installing them")
+	daemonCmd.AddCommand(installServiceCmd)
+}
+
+// addDaemonFlags registers the flags of the daemon on cmd
+func addDaemonFlags(cmd *cobra.Command) {
+	addEchoFlags(cmd)
+	cmd.Flags().StringVar(&pidFile, "pid-file", "", "Write the daemon's process ID to this file")
+	cmd.Flags().StringVar(&controlSocket, "control-socket", control.DefaultPath(), "Unix socket 'secure-transfer ctl' talks to")
+	cmd.Flags().BoolVar(&noControl, "no-control", false, "Do not open a control socket")
+}
+
+// startControl serves the control socket in the background and returns a
+// function that closes and removes it
+func startControl(address string, state *transfer.State, approvals *approval.Queue, reload func() error, shutdown func()) (func(), error) {
+	listener, err := control.Listen(controlSocket)
+	if err != nil {
+		return nil, fmt.Errorf("error opening control socket: %w", err)
+	}
+	server := &control.Server{
+		State:     state,
+		Address:   address,
+		Config:    configPath(),
+		Reload:    reload,
+		Shutdown:  shutdown,
+		Approvals: approvals,
+		Logger:    logger,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logger.Error("Control socket stopped", "error", err)
+		}
+	}()
+	logger.Info("Serving control socket", "path", controlSocket)
+	return func() { listener.Close() }, nil
+}
+
+// reloadOnHangup reloads whenever the process receives SIGHUP, until ctx
+// is done
+func reloadOnHangup(ctx context.Context, reload func() error) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := reload(); err != nil {
+				logger.Error("Reload failed", "error", err)
+			}
+		}
+	}
+}
+
+// reloadMu serializes reloads, which rewrite the flag variables and may
+// come from SIGHUP and several control connections at once
+var reloadMu sync.Mutex
+
+// reloadDaemon re-reads the config file and key and hands what a running
+// server can change to new connections. Flags given on the command line
+// keep their values.
+func reloadDaemon(cmd *cobra.Command, key []byte, opts transfer.Options) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	settings, _, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	for _, name := range config.Keys() {
+		flag := cmd.Flags().Lookup(config.FlagName(name))
+		if flag == nil || commandLineFlags[flag.Name] {
+			continue
+		}
+		// Settings removed from the file fall back to the flag default
+		value := settings.Get(name)
+		if value == "" {
+			value = flag.DefValue
+		}
+		if err := setFlag(flag, value); err != nil {
+			return fmt.Errorf("config setting %s: %w", name, err)
+		}
+	}
+
+	// An inherited descriptor can only be read once
+	if keyFD == 0 {
+		if keyFile == "" {
+			keyFile = filepath.Join(configDir, "transfer.key")
+		}
+		keys, err := loadKeys()
+		if err != nil {
+			return err
+		}
+		key = keys.Current
+		opts.PreviousKeys = keys.Accepted(time.Now())
+	}
+	if opts.Access, err = transfer.ParseAccessList(allow, deny); err != nil {
+		return err
+	}
+	if err := transfer.ValidateClipboardPolicy(clipboardMode); err != nil {
+		return err
+	}
+	opts.Clipboard = clipboardMode
+	opts.Limits = limits
+	if opts.Notifier, err = notify.New(notifyVia); err != nil {
+		return err
+	}
+	if opts.Approval != nil {
+		// Copied, as connections still being handled read the old list
+		reloaded := *opts.Approval
+		reloaded.Trusted = autoAccept
+		opts.Approval = &reloaded
+	}
+
+	opts.State.Update(key, opts)
+	logger.Info("Reloaded configuration", "config", configPath())
+	return nil
+}
+
+// setFlag sets a flag as if given on the command line, replacing rather
+// than appending to lists
+func setFlag(flag *pflag.Flag, value string) error {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		value = strings.Trim(value, "[]")
+		if value == "" {
+			return slice.Replace(nil)
+		}
+		return slice.Replace(strings.Split(value, ","))
+	}
+	return flag.Value.Set(value)
+}
+
+// daemonListener returns the socket passed by the service manager, or a
+// new listener when there is none
+func daemonListener(opts transfer.Options) (net.Listener, error) {
+	transport := opts.Transport
+	if transport == nil {
+		transport = transfer.TCPTransport{}
+	}
+
+	inherited, err := daemon.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(inherited) == 0 {
+		listener, err := transport.Listen(net.JoinHostPort(bind, strconv.Itoa(port)))
+		if err != nil {
+			return nil, fmt.Errorf("error starting server: %w", err)
+		}
+		return listener, nil
+	}
+
+	for _, extra := range inherited[1:] {
+		logger.Warn("Ignoring extra socket from service manager", "address", extra.Addr().String())
+		extra.Close()
+	}
+	logger.Info("Using socket from service manager", "address", inherited[0].Addr().String())
+	return transport.Wrap(inherited[0]), nil
+}
+
+// serviceUnit builds the units for the flags install-service was given
+func serviceUnit(cmd *cobra.Command) (daemon.Unit, error) {
+	if cmd.Flags().Changed("passphrase") {
+		return daemon.Unit{}, fmt.Errorf("--passphrase would be stored in the unit file; use --key-file or --keyring-account instead")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return daemon.Unit{}, err
+	}
+	dir, err := filepath.Abs(configDir)
+	if err != nil {
+		return daemon.Unit{}, err
+	}
+
+	command := []string{executable, "daemon", "--config-dir=" + dir}
+	var flagErr error
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if installOnlyFlags[flag.Name] {
+			return
+		}
+		value := flagText(flag)
+		if pathFlags[flag.Name] && value != "" {
+			abs, err := filepath.Abs(value)
+			if err != nil {
+				flagErr = err
+			}
+			value = abs
+		}
+		command = append(command, "--"+flag.Name+"="+value)
+	})
+	if flagErr != nil {
+		return daemon.Unit{}, flagErr
+	}
+
+	unit := daemon.Unit{Command: command}
+	if socketUnit {
+		unit.ListenStream = net.JoinHostPort(bind, strconv.Itoa(port))
+	}
+	return unit, nil
+}
@@ -22,9 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
+	"time"
 
-	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/addressbook"
+	"secure-transfer/internal/api"
 	"secure-transfer/internal/transfer"
 
 	"github.com/spf13/cobra"
@@ -35,11 +39,127 @@ var (
 		Use:   "echo",
 		Short: "Start echo server that copies received messages to clipboard",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			key, err := crypto.GetAESKey(logger)
+			if err := requireNoControlApproval(); err != nil {
+				return err
+			}
+			key, opts, err := echoSetup()
 			if err != nil {
-				return fmt.Errorf("error with encryption key: %w", err)
+				return err
 			}
-			return transfer.EchoResponse(port, key, logger)
+			return transfer.EchoResponse(port, key, opts, logger)
 		},
 	}
+
+	// Echo-specific flags
+	replayWindow time.Duration
+	replayCache  int
+	limits       transfer.Limits
+	apiAddr      string
+	historySize  int
 )
+
+func init() {
+	addEchoFlags(echoCmd)
+}
+
+// addEchoFlags registers the flags of the echo server on cmd
+func addEchoFlags(cmd *cobra.Command) {
+	addListenerFlags(cmd)
+	cmd.Flags().DurationVar(&replayWindow, "replay-window", 2*time.Minute, "Reject messages whose timestamp differs from the local clock by more than this")
+	cmd.Flags().IntVar(&replayCache, "replay-cache", 10000, "Number of recent message nonces remembered to reject replays")
+	cmd.Flags().IntVar(&limits.MaxConnections, "max-connections", 64, "Maximum concurrent connections (0 for unlimited)")
+	cmd.Flags().Float64Var(&limits.RatePerIP, "rate", 5, "Connections per second accepted from one IP (0 for unlimited)")
+	cmd.Flags().IntVar(&limits.Burst, "burst", 10, "Connections one IP may open at once before --rate applies")
+	cmd.Flags().DurationVar(&limits.ReadTimeout, "read-timeout", 30*time.Second, "Time allowed to receive a message")
+	cmd.Flags().DurationVar(&limits.WriteTimeout, "write-timeout", 10*time.Second, "Time allowed for each write to the sender")
+	cmd.Flags().DurationVar(&limits.IdleTimeout, "idle-timeout", 10*time.Second, "Close connections idle for this long")
+	cmd.Flags().StringVar(&apiAddr, "api-addr", "", "Serve the local HTTP API on this loopback address, e.g. 127.0.0.1:8765")
+	cmd.Flags().IntVar(&historySize, "history", 100, "Number of received messages GET /history returns")
+	cmd.Flags().IntVar(&limits.MaxPayload, "max-size", 16*1024*1024, "Largest message accepted in bytes")
+}
+
+// echoSetup loads the key and options of the echo server and starts the
+// local API when enabled
+func echoSetup() ([]byte, transfer.Options, error) {
+	keys, err := loadKeys()
+	if err != nil {
+		return nil, transfer.Options{}, err
+	}
+	opts, err := transferOptions(keys)
+	if err != nil {
+		return nil, opts, err
+	}
+	warnIfOpen()
+	opts.AuthorizedPeers = authorizedPeersFile()
+	if opts.Audit, err = openAuditLog(); err != nil {
+		return nil, opts, err
+	}
+	opts.Replay = transfer.NewReplayGuard(replayWindow, replayCache)
+	opts.Limits = limits
+	// Created before the API starts so it sees reloaded keys and options
+	opts.State = transfer.NewState()
+	if apiAddr != "" {
+		opts.History = transfer.NewHistory(historySize)
+		if err := startAPI(keys.Current, opts); err != nil {
+			return nil, opts, err
+		}
+	}
+	return keys.Current, opts, nil
+}
+
+// apiTokenFile returns the path of the local API token
+func apiTokenFile() string {
+	return filepath.Join(configDir, "api.token")
+}
+
+// startAPI serves the local HTTP API in the background
+func startAPI(key []byte, opts transfer.Options) error {
+	token, err := api.LoadOrCreateToken(apiTokenFile())
+	if err != nil {
+		return fmt.Errorf("error loading API token: %w", err)
+	}
+
+	server := &api.Server{
+		Token:   token,
+		History: opts.History,
+		Send:    apiSend(key, opts, port, parallel),
+		Peers: func() (*addressbook.Book, error) {
+			return addressbook.Load(addressBookFile())
+		},
+		Logger: logger,
+	}
+
+	listener, err := api.Listen(apiAddr)
+	if err != nil {
+		return fmt.Errorf("error starting API listener: %w", err)
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logger.Error("API server stopped", "error", err)
+		}
+	}()
+	logger.Info("Serving local API", "address", listener.Addr().String(), "token_file", apiTokenFile())
+	return nil
+}
+
+// apiSend returns the API's send function. Messages use the daemon's
+// current key and options, and are abandoned when the request is. The
+// default port and parallelism are fixed at startup, as reloads never
+// change them.
+func apiSend(key []byte, opts transfer.Options, defaultPort, parallelism int) api.SendFunc {
+	return func(ctx context.Context, target, message string) error {
+		key, opts := opts.State.Current(key, opts)
+		// Resolved like client --to, so names, groups and pinned
+		// fingerprints behave the same
+		recipients, err := resolveRecipients([]string{target}, defaultPort)
+		if err != nil {
+			return err
+		}
+		_, err = deliver(recipients, parallelism, func(r recipient) error {
+			opts := opts
+			opts.ReceiverFingerprint = r.fingerprint
+			return transfer.SendMessageContext(ctx, r.host, r.port, "", message, key, opts, logger)
+		})
+		return err
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+
+	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/transfer"
+)
+
+// testLogger returns a logger discarding everything tests log
+func testLogger(t *testing.T) *slog.Logger {
+	t.Helper()
+	return slog.New(slog.DiscardHandler)
+}
+
+func TestAPISendUsesReloadedKey(t *testing.T) {
+	logger = testLogger(t)
+	configDir = t.TempDir()
+	oldKey, _ := crypto.GenerateKey()
+	newKey, _ := crypto.GenerateKey()
+
+	// The receiver already uses the rotated key
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go transfer.ServeEcho(listener, newKey, transfer.Options{Clipboard: transfer.ClipboardNever}, logger)
+	target := listener.Addr().String()
+
+	opts := transfer.Options{State: transfer.NewState()}
+	send := apiSend(oldKey, opts, 8080, 1)
+	if err := send(context.Background(), target, "before reload"); err == nil {
+		t.Fatal("Send with the retired key succeeded")
+	}
+
+	// What reloadDaemon does after `key rotate`
+	opts.State.Update(newKey, opts)
+	if err := send(context.Background(), target, "after reload"); err != nil {
+		t.Errorf("Send after reload failed: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+
+	"secure-transfer/internal/transfer"
+)
+
+// Exit codes let scripts tell failures apart. Failures outside the
+// categories below exit with ExitFailure.
+const (
+	ExitOK                   = 0
+	ExitFailure              = 1
+	ExitUsage                = 2
+	ExitPeerUnreachable      = 3
+	ExitAuthFailed           = 4
+	ExitIntegrity            = 5
+	ExitTooLarge             = 6
+	ExitClipboardUnavailable = 7
+	ExitRejected             = 8
+	ExitPartial              = 9
+	ExitProtocol             = 10
+	ExitReplayed             = 11
+)
+
+// usageError marks invalid command-line flags
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// ExitCode returns the process exit code for an error returned by Execute
+func ExitCode(err error) int {
+	var usage *usageError
+	var fanout *transfer.FanoutError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &usage):
+		return ExitUsage
+	case errors.As(err, &fanout):
+		return fanoutExitCode(fanout)
+	case errors.Is(err, transfer.ErrPeerUnreachable):
+		return ExitPeerUnreachable
+	case errors.Is(err, transfer.ErrAuthFailed):
+		return ExitAuthFailed
+	case errors.Is(err, transfer.ErrProtocol):
+		return ExitProtocol
+	case errors.Is(err, transfer.ErrReplayed):
+		return ExitReplayed
+	case errors.Is(err, transfer.ErrIntegrity):
+		return ExitIntegrity
+	case errors.Is(err, transfer.ErrTooLarge):
+		return ExitTooLarge
+	case errors.Is(err, transfer.ErrClipboardUnavailable):
+		return ExitClipboardUnavailable
+	case errors.Is(err, transfer.ErrRejected):
+		return ExitRejected
+	}
+	return ExitFailure
+}
+
+// fanoutExitCode combines the failures of a send to several recipients:
+// ExitPartial when some recipients were reached, otherwise the code the
+// failures share, or ExitFailure when they differ
+func fanoutExitCode(fanout *transfer.FanoutError) int {
+	if len(fanout.Failed) < fanout.Total {
+		return ExitPartial
+	}
+	code := ExitCode(fanout.Failed[0].Err)
+	for _, d := range fanout.Failed[1:] {
+		if ExitCode(d.Err) != code {
+			return ExitFailure
+		}
+	}
+	return code
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"secure-transfer/internal/transfer"
+
+	"github.com/spf13/cobra"
+)
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Success", nil, ExitOK},
+		{"Peer unreachable", transfer.ErrPeerUnreachable, ExitPeerUnreachable},
+		{"Auth failed", transfer.ErrAuthFailed, ExitAuthFailed},
+		{"Protocol mismatch", transfer.ErrProtocol, ExitProtocol},
+		{"Replayed", transfer.ErrReplayed, ExitReplayed},
+		{"Integrity", transfer.ErrIntegrity, ExitIntegrity},
+		{"Too large", transfer.ErrTooLarge, ExitTooLarge},
+		{"Clipboard unavailable", transfer.ErrClipboardUnavailable, ExitClipboardUnavailable},
+		{"Rejected", transfer.ErrRejected, ExitRejected},
+		{"Other failure", errors.New("disk full"), ExitFailure},
+		{"Wrapped", fmt.Errorf("error sending file: %w", fmt.Errorf("%w: connection refused", transfer.ErrPeerUnreachable)), ExitPeerUnreachable},
+		{"Usage", &usageError{errors.New("--ip and --to cannot be combined")}, ExitUsage},
+		{"Wrapped usage", fmt.Errorf("peer laptop: %w", &usageError{errors.New("invalid port")}), ExitUsage},
+		{"Partial fan-out", &transfer.FanoutError{
+			Failed: []transfer.Delivery{{Address: "a:1", Err: transfer.ErrPeerUnreachable}},
+			Total:  2,
+		}, ExitPartial},
+		{"Total fan-out with one cause", &transfer.FanoutError{
+			Failed: []transfer.Delivery{
+				{Address: "a:1", Err: transfer.ErrAuthFailed},
+				{Address: "b:1", Err: fmt.Errorf("%w: not authorized", transfer.ErrAuthFailed)},
+			},
+			Total: 2,
+		}, ExitAuthFailed},
+		{"Total fan-out with mixed causes", &transfer.FanoutError{
+			Failed: []transfer.Delivery{
+				{Address: "a:1", Err: transfer.ErrAuthFailed},
+				{Address: "b:1", Err: transfer.ErrPeerUnreachable},
+			},
+			Total: 2,
+		}, ExitFailure},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ExitCode(tc.err); got != tc.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestArgumentErrorsAreUsageErrors(t *testing.T) {
+	// A tree shaped like the real one, without its side effects
+	newRoot := func() *cobra.Command {
+		root := &cobra.Command{Use: "secure-transfer"}
+		group := &cobra.Command{Use: "trust"}
+		group.AddCommand(&cobra.Command{
+			Use:  "remove <name>",
+			Args: cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error { return nil },
+		})
+		root.AddCommand(group)
+		root.SetOut(io.Discard)
+		root.SetErr(io.Discard)
+		markArgErrors(root)
+		return root
+	}
+
+	testCases := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"Valid", []string{"trust", "remove", "laptop"}, ExitOK},
+		{"Group alone", []string{"trust"}, ExitOK},
+		{"Missing argument", []string{"trust", "remove"}, ExitUsage},
+		{"Extra argument", []string{"trust", "remove", "a", "b"}, ExitUsage},
+		{"Unknown command", []string{"trsut"}, ExitUsage},
+		{"Unknown subcommand", []string{"trust", "bogus"}, ExitUsage},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := newRoot()
+			root.SetArgs(tc.args)
+			if got := ExitCode(root.Execute()); got != tc.want {
+				t.Errorf("Exit code = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"secure-transfer/internal/crypto"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyCmd = &cobra.Command{
+		Use:   "key",
+		Short: "Manage the shared encryption key",
+	}
+
+	keyGenerateCmd = &cobra.Command{
+		Use:   "generate",
+		Short: "Generate a new key file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := os.Stat(keyFile); err == nil && !force {
+				return fmt.Errorf("key file %s already exists (use --force to overwrite or 'key rotate')", keyFile)
+			}
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				return err
+			}
+			if err := crypto.SaveKeyFile(keyFile, &crypto.KeySet{Current: key}); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Generated key %s in %s\n", crypto.KeyID(key), keyFile)
+			return nil
+		},
+	}
+
+	keyExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Print the current key for sharing with peers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := crypto.LoadKeyFile(keyFile)
+			if err != nil {
+				return err
+			}
+			text, err := crypto.ExportKey(keys.Current, keyFormat)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), text)
+			return nil
+		},
+	}
+
+	keyImportCmd = &cobra.Command{
+		Use:   "import [key]",
+		Short: "Import a key exported by a peer, reading stdin when no key is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			text := strings.Join(args, " ")
+			if text == "" {
+				data, err := io.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return err
+				}
+				text = string(data)
+			}
+			key, err := crypto.ImportKey(text)
+			if err != nil {
+				return err
+			}
+
+			keys, err := crypto.LoadKeyFile(keyFile)
+			if errors.Is(err, os.ErrNotExist) {
+				keys = &crypto.KeySet{}
+			} else if err != nil {
+				return err
+			}
+			keys.Replace(key, grace)
+			if err := crypto.SaveKeyFile(keyFile, keys); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Imported key %s into %s\n", crypto.KeyID(key), keyFile)
+			return nil
+		},
+	}
+
+	keyRotateCmd = &cobra.Command{
+		Use:   "rotate",
+		Short: "Replace the current key, still accepting the old one during a grace period",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := crypto.LoadKeyFile(keyFile)
+			if err != nil {
+				return err
+			}
+			if err := keys.Rotate(grace); err != nil {
+				return err
+			}
+			if err := crypto.SaveKeyFile(keyFile, keys); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Rotated to key %s, old key accepted until %s\n",
+				crypto.KeyID(keys.Current), time.Now().Add(grace).Format(time.RFC3339))
+			return nil
+		},
+	}
+
+	// Key source flags
+	keyFD          int
+	keyringAccount string
+
+	// Passphrase flags
+	passphrase string
+	kdfTime    uint32
+	kdfMemory  uint32
+	kdfThreads uint8
+
+	// Key-specific flags
+	force     bool
+	keyFormat string
+	grace     time.Duration
+)
+
+func init() {
+	keyGenerateCmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing key file")
+	keyExportCmd.Flags().StringVar(&keyFormat, "format", crypto.FormatBase64, "Export format (base64, qr)")
+	keyImportCmd.Flags().DurationVar(&grace, "grace", 0, "Keep accepting the replaced key for this long")
+	keyRotateCmd.Flags().DurationVar(&grace, "grace", 24*time.Hour, "Keep accepting the old key for this long")
+
+	keyCmd.AddCommand(keyGenerateCmd)
+	keyCmd.AddCommand(keyExportCmd)
+	keyCmd.AddCommand(keyImportCmd)
+	keyCmd.AddCommand(keyRotateCmd)
+}
+
+// loadKeys loads the encryption key, adding a remediation hint to key errors
+func loadKeys() (*crypto.KeySet, error) {
+	// Keys are derived per transfer when a passphrase is used
+	if transferPassphrase() != "" {
+		return &crypto.KeySet{}, nil
+	}
+
+	keyOptions := crypto.KeyOptions{
+		File:           keyFile,
+		FD:             keyFD,
+		KeyringAccount: keyringAccount,
+	}
+	keys, err := crypto.GetAESKey(keyOptions, logger)
+	if err != nil {
+		if hint := keyErrorHint(err); hint != "" {
+			return nil, fmt.Errorf("error with encryption key: %w\nhint: %s", err, hint)
+		}
+		return nil, fmt.Errorf("error with encryption key: %w", err)
+	}
+	return keys, nil
+}
+
+// keyErrorHint suggests how to fix a key loading error
+func keyErrorHint(err error) string {
+	var lengthErr *crypto.KeyLengthError
+	var encodingErr *crypto.KeyEncodingError
+	var sourceErr *crypto.KeySourceError
+	switch {
+	case errors.Is(err, crypto.ErrNoKey):
+		return fmt.Sprintf("run 'secure-transfer key generate' to create %s, or set TRANSFER_KEY", keyFile)
+	case errors.As(err, &lengthErr):
+		return "keys must be 32 random bytes; create one with 'secure-transfer key generate'"
+	case errors.As(err, &encodingErr):
+		return "give the key as base64 or hex, for example the output of 'secure-transfer key export'"
+	case errors.As(err, &sourceErr):
+		return "check that the file descriptor or keyring entry exists and is readable"
+	default:
+		return ""
+	}
+}
+
+// transferPassphrase returns --passphrase, falling back to TRANSFER_PASSPHRASE
+func transferPassphrase() string {
+	if passphrase != "" {
+		return passphrase
+	}
+	return os.Getenv("TRANSFER_PASSPHRASE")
+}
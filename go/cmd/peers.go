@@ -0,0 +1,184 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"secure-transfer/internal/addressbook"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	peersCmd = &cobra.Command{
+		Use:   "peers",
+		Short: "Manage the address book of receivers to send to",
+		Long: `Manage the address book of receivers to send to.
+
+Peers and groups of peers are named so that 'client --ip' and
+'client --to' can be given names instead of addresses. A peer recorded
+with a fingerprint must prove that identity when sent to. When such a
+peer recorded by IP address is seen at a new address, proving its
+identity in a transfer either way, the address book follows it.`,
+	}
+
+	peersAddCmd = &cobra.Command{
+		Use:   "add <name> <host[:port]>",
+		Short: "Add a peer to the address book",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			book, err := addressbook.Load(addressBookFile())
+			if err != nil {
+				return err
+			}
+			peer := addressbook.Peer{Name: args[0], Address: args[1], Fingerprint: peerFingerprint, Tags: peerTags}
+			if err := book.Add(peer); err != nil {
+				return err
+			}
+			if err := book.Save(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Added %s (%s)\n", peer.Name, peer.Address)
+			return nil
+		},
+	}
+
+	peersRemoveCmd = &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a peer or group from the address book",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			book, err := addressbook.Load(addressBookFile())
+			if err != nil {
+				return err
+			}
+			if err := book.Remove(args[0]); err != nil {
+				return err
+			}
+			return book.Save()
+		},
+	}
+
+	peersListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the peers and groups in the address book",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			book, err := addressbook.Load(addressBookFile())
+			if err != nil {
+				return err
+			}
+			peers := book.List(peerTag)
+			if len(peers) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No peers in the address book")
+				return nil
+			}
+			out := cmd.OutOrStdout()
+			for _, peer := range peers {
+				fingerprint := peer.Fingerprint
+				if fingerprint == "" {
+					fingerprint = "-"
+				}
+				fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", peer.Name, peer.Address, fingerprint, strings.Join(peer.Tags, ","))
+			}
+			if peerTag != "" {
+				return nil
+			}
+			groups := make([]string, 0, len(book.Groups))
+			for name := range book.Groups {
+				groups = append(groups, name)
+			}
+			slices.Sort(groups)
+			for _, name := range groups {
+				fmt.Fprintf(out, "%s (group)\t%s\n", name, strings.Join(book.Groups[name], ","))
+			}
+			return nil
+		},
+	}
+
+	peersGroupCmd = &cobra.Command{
+		Use:   "group <name> <peer>...",
+		Short: "Define a group of peers, replacing any group of the same name",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			book, err := addressbook.Load(addressBookFile())
+			if err != nil {
+				return err
+			}
+			if err := book.SetGroup(args[0], args[1:]); err != nil {
+				return err
+			}
+			if err := book.Save(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Group %s: %s\n", args[0], strings.Join(book.Groups[args[0]], ", "))
+			return nil
+		},
+	}
+
+	// Peers-specific flags
+	peerFingerprint string
+	peerTags        []string
+	peerTag         string
+
+	// bookMu serializes address book updates from concurrent transfers
+	bookMu sync.Mutex
+)
+
+func init() {
+	peersAddCmd.Flags().StringVar(&peerFingerprint, "fingerprint", "", "Identity fingerprint the peer must prove, as printed by 'trust self'")
+	peersAddCmd.Flags().StringSliceVar(&peerTags, "tag", nil, "Tags to label the peer with")
+	peersListCmd.Flags().StringVar(&peerTag, "tag", "", "Only list peers with this tag")
+
+	peersCmd.AddCommand(peersAddCmd)
+	peersCmd.AddCommand(peersRemoveCmd)
+	peersCmd.AddCommand(peersListCmd)
+	peersCmd.AddCommand(peersGroupCmd)
+}
+
+// updateAddressBook moves address book peers to where they were just
+// seen proving their identity
+func updateAddressBook(address, fingerprint string) {
+	bookMu.Lock()
+	defer bookMu.Unlock()
+
+	book, err := addressbook.Load(addressBookFile())
+	if err != nil {
+		logger.Warn("Could not read address book", "error", err)
+		return
+	}
+	updates := book.Discovered([]addressbook.Sighting{{Fingerprint: fingerprint, Address: address}})
+	if len(updates) == 0 {
+		return
+	}
+	if err := book.Save(); err != nil {
+		logger.Warn("Could not update address book", "error", err)
+		return
+	}
+	for _, update := range updates {
+		logger.Info("Peer address changed", "name", update.Name, "old", update.Old, "new", update.New)
+	}
+}
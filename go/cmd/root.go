@@ -22,10 +22,29 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"secure-transfer/internal/approval"
+	"secure-transfer/internal/audit"
+	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/identity"
+	"secure-transfer/internal/logging"
+	"secure-transfer/internal/metrics"
+	"secure-transfer/internal/notify"
+	"secure-transfer/internal/transfer"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -33,50 +52,379 @@ var (
 		Use:   "secure-transfer",
 		Short: "Securely transfer files or messages over TCP",
 		Long:  "A tool for securely transferring files or messages using AES encryption over TCP",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			setupLogger()
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Flags parsed, so later failures are not usage mistakes
+			cmd.SilenceUsage = true
+			cmd.Flags().Visit(func(flag *pflag.Flag) { commandLineFlags[flag.Name] = true })
+			settings, _, err := loadSettings()
+			if err != nil {
+				return err
+			}
+			if err := applySettings(cmd, settings); err != nil {
+				return err
+			}
+			if err := setupLogger(); err != nil {
+				return err
+			}
+			if keyFile == "" {
+				keyFile = filepath.Join(configDir, "transfer.key")
+			}
+			return nil
 		},
 	}
 
 	// Global flags
-	port     int
-	logLevel string
-	logger   *slog.Logger
+	port          int
+	logLevel      string
+	logFormat     string
+	logFile       string
+	logMaxSize    int64
+	logMaxFiles   int
+	transportName string
+	cipherName    string
+	configDir     string
+	configFile    string
+	profile       string
+	keyFile       string
+
+	// Listener flags shared by server and echo
+	bind          string
+	allow         []string
+	deny          []string
+	clipboardMode string
+	metricsAddr   string
+	auditLog      string
+	noAudit       bool
+	approveVia    []string
+	autoAccept    []string
+	approveWait   time.Duration
+	notifyVia     string
+	noPreview     bool
+
+	// commandLineFlags are the flags given on the command line, which
+	// config settings never override
+	commandLineFlags = make(map[string]bool)
+
+	logger *slog.Logger
 )
 
 // Execute executes the root command.
 func Execute() error {
+	markArgErrors(rootCmd)
 	return rootCmd.Execute()
 }
 
+// markArgErrors makes wrong arguments usage errors throughout the command
+// tree, as SetFlagErrorFunc does for flags. Commands that only group
+// subcommands reject anything else as an unknown command rather than
+// printing their help and succeeding.
+func markArgErrors(cmd *cobra.Command) {
+	if cmd.HasSubCommands() && !cmd.Runnable() {
+		cmd.Args = unknownSubcommand
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		}
+	} else if validate := cmd.Args; validate != nil {
+		cmd.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return &usageError{err: err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markArgErrors(sub)
+	}
+}
+
+// unknownSubcommand rejects arguments to a command that only groups
+// subcommands, suggesting close matches as cobra does
+func unknownSubcommand(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("unknown command %q for %q", args[0], cmd.CommandPath())
+	if suggestions := cmd.SuggestionsFor(args[0]); len(suggestions) > 0 {
+		err = fmt.Errorf("%w\n\nDid you mean this?\n\t%s", err, strings.Join(suggestions, "\n\t"))
+	}
+	return &usageError{err: err}
+}
+
 func init() {
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", logging.FormatText, "Log format (text, json)")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Write logs to this file instead of stderr")
+	rootCmd.PersistentFlags().Int64Var(&logMaxSize, "log-max-size", 10, "Rotate the log file when it reaches this many MiB (0 disables)")
+	rootCmd.PersistentFlags().IntVar(&logMaxFiles, "log-max-files", 5, "Number of rotated log files to keep")
 	rootCmd.PersistentFlags().IntVarP(&port, "port", "p", 8080, "Port to use for connection")
+	rootCmd.PersistentFlags().StringVar(&cipherName, "cipher", "", "Cipher suite to require (aes-256-gcm, xchacha20-poly1305); negotiated when empty")
+	rootCmd.PersistentFlags().StringVar(&transportName, "transport", transfer.TransportTCP, "Transport to use (tcp, tls)")
+	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", defaultConfigDir(), "Directory holding certificates and peer files")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file (default <config-dir>/config.toml, or set TRANSFER_CONFIG)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Config profile to apply over the defaults (or set TRANSFER_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&keyFile, "key-file", "", "Key file used when TRANSFER_KEY is unset (default <config-dir>/transfer.key)")
+	rootCmd.PersistentFlags().IntVar(&keyFD, "key-fd", 0, "Read the key from this inherited file descriptor")
+	rootCmd.PersistentFlags().StringVar(&keyringAccount, "keyring-account", "", "Read the key from this OS keyring account")
+	rootCmd.PersistentFlags().StringVar(&passphrase, "passphrase", "", "Derive the key from a passphrase instead (or set TRANSFER_PASSPHRASE)")
+	rootCmd.PersistentFlags().Uint32Var(&kdfTime, "kdf-time", crypto.DefaultKDFParams.Time, "Argon2id passes when deriving from a passphrase")
+	rootCmd.PersistentFlags().Uint32Var(&kdfMemory, "kdf-memory", crypto.DefaultKDFParams.Memory, "Argon2id memory in KiB when deriving from a passphrase")
+	rootCmd.PersistentFlags().Uint8Var(&kdfThreads, "kdf-threads", crypto.DefaultKDFParams.Threads, "Argon2id parallelism when deriving from a passphrase")
 
 	// Add subcommands
 	rootCmd.AddCommand(clientCmd)
 	rootCmd.AddCommand(serverCmd)
 	rootCmd.AddCommand(echoCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(ctlCmd)
+	rootCmd.AddCommand(trustCmd)
+	rootCmd.AddCommand(peersCmd)
+	rootCmd.AddCommand(keyCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(auditCmd)
 }
 
-func setupLogger() {
-	var level slog.Level
-	switch logLevel {
-	case "debug":
-		level = slog.LevelDebug
-	case "info":
-		level = slog.LevelInfo
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
-		level = slog.LevelInfo
+// setupLogger builds the logger from the log flags. Logs go to stderr,
+// keeping stdout for command output, or to a rotated file.
+func setupLogger() error {
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stderr
+	if logFile != "" {
+		w, err = logging.OpenRotatingFile(logFile, logMaxSize*1024*1024, logMaxFiles)
+		if err != nil {
+			return fmt.Errorf("error opening log file: %w", err)
+		}
 	}
 
-	opts := &slog.HandlerOptions{
-		Level: level,
+	handler, err := logging.NewHandler(w, logFormat, level)
+	if err != nil {
+		return err
 	}
-	handler := slog.NewTextHandler(os.Stdout, opts)
 	logger = slog.New(handler)
+	return nil
+}
+
+// defaultConfigDir returns the per-user configuration directory
+func defaultConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".secure-transfer"
+	}
+	return filepath.Join(dir, "secure-transfer")
+}
+
+// addListenerFlags registers the flags of commands that accept connections
+func addListenerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&bind, "bind", "0.0.0.0", "Address to listen on")
+	cmd.Flags().StringSliceVar(&allow, "allow", nil, "Only accept connections from these CIDR ranges or addresses")
+	cmd.Flags().StringSliceVar(&deny, "deny", nil, "Refuse connections from these CIDR ranges or addresses")
+	cmd.Flags().StringVar(&auditLog, "audit-log", "", "Append received items to this hash-chained log (default <config-dir>/audit.log)")
+	cmd.Flags().BoolVar(&noAudit, "no-audit", false, "Do not keep an audit log of received items")
+	cmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address, e.g. 127.0.0.1:9090")
+	cmd.Flags().StringVar(&clipboardMode, "clipboard", transfer.ClipboardAuto, "Copy received content to the clipboard (auto: below 1 MiB, always, never)")
+	cmd.Flags().StringSliceVar(&approveVia, "approve", nil, "Hold received items until accepted from these frontends (terminal, notify, control)")
+	cmd.Flags().StringSliceVar(&autoAccept, "auto-accept", nil, "Peers, by name or fingerprint, whose items need no approval")
+	cmd.Flags().DurationVar(&approveWait, "approve-timeout", 2*time.Minute, "Reject held items not decided within this time")
+	cmd.Flags().StringVar(&notifyVia, "notify", notify.BackendAuto, "Show a notification for received items (auto, notify-send, dbus, termux, none)")
+	cmd.Flags().BoolVar(&noPreview, "no-notify-preview", false, "Leave the start of the content out of notifications")
+}
+
+// identityFile returns the path of the local identity key
+func identityFile() string {
+	return filepath.Join(configDir, "identity.pem")
+}
+
+// authorizedPeersFile returns the path of the authorized peers list
+func authorizedPeersFile() string {
+	return filepath.Join(configDir, "authorized_peers")
+}
+
+// knownReceiversFile returns the path where senders pin receiver identities
+func knownReceiversFile() string {
+	return filepath.Join(configDir, "known_receivers")
+}
+
+// addressBookFile returns the path of the address book
+func addressBookFile() string {
+	return filepath.Join(configDir, "peers.toml")
+}
+
+// auditLogFile returns the path of the audit log
+func auditLogFile() string {
+	if auditLog != "" {
+		return auditLog
+	}
+	return filepath.Join(configDir, "audit.log")
+}
+
+// openAuditLog opens the audit log of receivers unless disabled
+func openAuditLog() (*audit.Log, error) {
+	if noAudit {
+		return nil, nil
+	}
+	log, err := audit.Open(auditLogFile())
+	var chainErr *audit.ChainError
+	if errors.As(err, &chainErr) {
+		return nil, fmt.Errorf("error opening audit log: %w (run 'secure-transfer audit verify' to check it)", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	if dropped := log.Dropped(); dropped > 0 {
+		logger.Warn("Removed an interrupted entry from the end of the audit log", "audit_log", auditLogFile(), "bytes", dropped)
+	}
+	logger.Debug("Recording received items", "audit_log", auditLogFile())
+	return log, nil
+}
+
+// warnIfOpen warns receivers that accept any sender holding the key
+func warnIfOpen() {
+	_, enforced, err := identity.LoadAllowList(authorizedPeersFile())
+	if err != nil {
+		logger.Warn("Could not read authorized peers", "file", authorizedPeersFile(), "error", err)
+	} else if !enforced {
+		logger.Warn("No authorized peers configured, accepting any sender holding the key", "file", authorizedPeersFile())
+	}
+}
+
+// transferOptions builds the transfer options shared by all commands
+func transferOptions(keys *crypto.KeySet) (transfer.Options, error) {
+	self, err := identity.LoadOrCreate(identityFile())
+	if err != nil {
+		return transfer.Options{}, fmt.Errorf("error loading identity: %w", err)
+	}
+	logger.Debug("Loaded identity", "fingerprint", identity.Fingerprint(self.PublicKey()))
+
+	opts := transfer.Options{
+		Compression:  compression,
+		Cipher:       cipherName,
+		Identity:     self,
+		PreviousKeys: keys.Accepted(time.Now()),
+		Passphrase:   transferPassphrase(),
+		// Only consulted by senders
+		KnownReceivers: knownReceiversFile(),
+		KDF: crypto.KDFParams{
+			Time:    kdfTime,
+			Memory:  kdfMemory,
+			Threads: kdfThreads,
+		},
+	}
+	if opts.Access, err = transfer.ParseAccessList(allow, deny); err != nil {
+		return opts, err
+	}
+	opts.Bind = bind
+	opts.Sighted = updateAddressBook
+	if clipboardMode != "" {
+		if err := transfer.ValidateClipboardPolicy(clipboardMode); err != nil {
+			return opts, err
+		}
+		opts.Clipboard = clipboardMode
+	}
+
+	if len(approveVia) > 0 {
+		if opts.Approval, err = approvalOptions(); err != nil {
+			return opts, err
+		}
+	}
+	if notifyVia != "" {
+		if opts.Notifier, err = notify.New(notifyVia); err != nil {
+			return opts, err
+		}
+		opts.NotifyPreview = !noPreview
+	}
+
+	if cipherName != "" {
+		if _, err := crypto.CipherByName(cipherName); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Passphrase != "" {
+		if err := opts.KDF.Validate(); err != nil {
+			return opts, err
+		}
+	}
+
+	if metricsAddr != "" {
+		if opts.Metrics, err = serveMetrics(metricsAddr); err != nil {
+			return opts, err
+		}
+	}
+
+	switch transportName {
+	case transfer.TransportTCP:
+	case transfer.TransportTLS:
+		tlsTransport, err := transfer.NewTLSTransport(filepath.Join(configDir, "tls"), logger)
+		if err != nil {
+			return opts, err
+		}
+		logger.Info("Using TLS transport", "fingerprint", tlsTransport.Fingerprint())
+		opts.Transport = tlsTransport
+	default:
+		return opts, fmt.Errorf("unknown transport %q (want tcp or tls)", transportName)
+	}
+	return opts, nil
+}
+
+// approvalOptions holds received items in a queue that the --approve
+// frontends answer
+func approvalOptions() (*transfer.Approval, error) {
+	if err := approval.ValidateFrontends(approveVia); err != nil {
+		return nil, err
+	}
+	var prompters []approval.Prompter
+	for _, frontend := range approveVia {
+		switch frontend {
+		case approval.FrontendTerminal:
+			prompters = append(prompters, approval.NewTerminal(os.Stdin, os.Stderr))
+		case approval.FrontendNotify:
+			prompters = append(prompters, approval.NotifySend{Logger: logger})
+		}
+	}
+	queue := approval.NewQueue(approveWait, logger, prompters...)
+	return &transfer.Approval{Approver: queue, Trusted: autoAccept}, nil
+}
+
+// approvalQueue returns the queue behind opts.Approval, if any
+func approvalQueue(opts transfer.Options) *approval.Queue {
+	if opts.Approval == nil {
+		return nil
+	}
+	queue, _ := opts.Approval.Approver.(*approval.Queue)
+	return queue
+}
+
+// requireNoControlApproval refuses --approve control outside the daemon,
+// which is the only command with a control socket
+func requireNoControlApproval() error {
+	if slices.Contains(approveVia, approval.FrontendControl) {
+		return &usageError{errors.New("--approve control needs the control socket of 'secure-transfer daemon'")}
+	}
+	return nil
+}
+
+// serveMetrics starts the metrics endpoint in the background
+func serveMetrics(addr string) (*transfer.Metrics, error) {
+	reg := metrics.NewRegistry()
+	m := transfer.NewMetrics(reg)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error starting metrics listener: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.Error("Metrics server stopped", "error", err)
+		}
+	}()
+
+	logger.Info("Serving metrics", "address", "http://"+listener.Addr().String()+"/metrics")
+	return m, nil
 }
@@ -23,8 +23,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
-	"secure-transfer/internal/crypto"
 	"secure-transfer/internal/transfer"
 
 	"github.com/spf13/cobra"
@@ -35,18 +36,41 @@ var (
 		Use:   "server",
 		Short: "Receive a file",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			key, err := crypto.GetAESKey(logger)
+			if err := requireNoControlApproval(); err != nil {
+				return err
+			}
+			keys, err := loadKeys()
+			if err != nil {
+				return err
+			}
+			opts, err := transferOptions(keys)
 			if err != nil {
-				return fmt.Errorf("error with encryption key: %w", err)
+				return err
+			}
+			warnIfOpen()
+			opts.AuthorizedPeers = authorizedPeersFile()
+			if opts.Audit, err = openAuditLog(); err != nil {
+				return err
+			}
+
+			path := saveAs
+			if saveDir != "" && !filepath.IsAbs(path) {
+				if err := os.MkdirAll(saveDir, 0755); err != nil {
+					return fmt.Errorf("error creating save directory: %w", err)
+				}
+				path = filepath.Join(saveDir, path)
 			}
-			return transfer.ReceiveFile(port, saveAs, key, logger)
+			return transfer.ReceiveFile(port, path, keys.Current, opts, logger)
 		},
 	}
 
 	// Server-specific flags
-	saveAs string
+	saveAs  string
+	saveDir string
 )
 
 func init() {
+	addListenerFlags(serverCmd)
 	serverCmd.Flags().StringVarP(&saveAs, "save", "s", "received_file", "Save received file as")
+	serverCmd.Flags().StringVar(&saveDir, "save-dir", "", "Directory relative --save paths are resolved against")
 }
@@ -0,0 +1,107 @@
+/*
+Copyright © 2025 Vidyasagar Gopi vidyasagar0405@gmail.com
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"secure-transfer/internal/identity"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	trustCmd = &cobra.Command{
+		Use:   "trust",
+		Short: "Manage the peers allowed to send to this device",
+	}
+
+	trustAddCmd = &cobra.Command{
+		Use:   "add <name> <public-key>",
+		Short: "Authorize a peer's identity key",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			publicKey, err := identity.ParsePublicKey(strings.Join(args[1:], " "))
+			if err != nil {
+				return err
+			}
+			peer := identity.Peer{Name: args[0], PublicKey: publicKey}
+			if err := identity.AddPeer(authorizedPeersFile(), peer); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Trusted %s (%s)\n", peer.Name, peer.Fingerprint())
+			return nil
+		},
+	}
+
+	trustListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List authorized peers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			peers, enforced, err := identity.LoadAllowList(authorizedPeersFile())
+			if err != nil {
+				return err
+			}
+			if !enforced {
+				fmt.Fprintln(cmd.OutOrStdout(), "No authorized peers, any sender holding the key is accepted")
+				return nil
+			}
+			for _, peer := range peers {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", peer.Name, peer.Fingerprint())
+			}
+			return nil
+		},
+	}
+
+	trustRemoveCmd = &cobra.Command{
+		Use:   "remove <name|fingerprint>",
+		Short: "Revoke a peer's authorization",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return identity.RemovePeer(authorizedPeersFile(), args[0])
+		},
+	}
+
+	trustSelfCmd = &cobra.Command{
+		Use:   "self",
+		Short: "Print this device's public identity key for peers to trust",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			self, err := identity.LoadOrCreate(identityFile())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), identity.FormatPublicKey(self.PublicKey()))
+			fmt.Fprintln(cmd.OutOrStdout(), identity.Fingerprint(self.PublicKey()))
+			return nil
+		},
+	}
+)
+
+func init() {
+	trustCmd.AddCommand(trustAddCmd)
+	trustCmd.AddCommand(trustListCmd)
+	trustCmd.AddCommand(trustRemoveCmd)
+	trustCmd.AddCommand(trustSelfCmd)
+}
@@ -2,9 +2,15 @@ module secure-transfer
 
 go 1.24.0
 
-require github.com/spf13/cobra v1.9.1
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/klauspost/compress v1.18.0
+	github.com/spf13/cobra v1.9.1
+	github.com/spf13/pflag v1.0.6
+	golang.org/x/crypto v0.39.0
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.6 // indirect
+	golang.org/x/sys v0.33.0 // indirect
 )
@@ -0,0 +1,265 @@
+package addressbook
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// fingerprintPattern matches identity.Fingerprint output
+var fingerprintPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// Peer is a receiver known by name
+type Peer struct {
+	Name string `toml:"-"`
+
+	// Address is host:port, or just a host reached on the default port
+	Address string `toml:"address"`
+
+	// Fingerprint, when set, is the identity the receiver must prove
+	Fingerprint string   `toml:"fingerprint,omitempty"`
+	Tags        []string `toml:"tags,omitempty"`
+}
+
+// Book is the address book file: named peers and groups of them
+type Book struct {
+	Peers  map[string]Peer     `toml:"peers,omitempty"`
+	Groups map[string][]string `toml:"groups,omitempty"`
+
+	// Path is where the book is read from and saved to
+	Path string `toml:"-"`
+}
+
+// Sighting is a peer seen at Address proving the identity Fingerprint.
+// Address is host:port, or only a host when the port is unknown.
+type Sighting struct {
+	Fingerprint string
+	Address     string
+}
+
+// Update is a peer address changed by Discovered
+type Update struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// Load reads an address book. A missing file yields an empty book.
+func Load(path string) (*Book, error) {
+	b := &Book{Path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := toml.Decode(string(data), b); err != nil {
+		return nil, fmt.Errorf("malformed address book %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Save writes the book back to its path
+func (b *Book) Save() error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(b); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0700); err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated book
+	tmp := b.Path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.Path)
+}
+
+// ValidateName checks a peer or group name can be told apart from an
+// address and used in a comma-separated list of targets
+func ValidateName(name string) error {
+	if name == "" || strings.ContainsAny(name, ",:[] \t\r\n") {
+		return fmt.Errorf("invalid name %q (names cannot contain commas, colons, brackets or spaces)", name)
+	}
+	return nil
+}
+
+// SplitAddress splits host:port, using defaultPort for a bare host
+func SplitAddress(address string, defaultPort int) (string, int, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		// No port given; a bare IPv6 address may still be bracketed
+		return strings.Trim(address, "[]"), defaultPort, nil
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in address %q", address)
+	}
+	return host, port, nil
+}
+
+// Add adds a peer, refusing names already used by a peer or group
+func (b *Book) Add(peer Peer) error {
+	if err := ValidateName(peer.Name); err != nil {
+		return err
+	}
+	if _, ok := b.Peers[peer.Name]; ok {
+		return fmt.Errorf("peer %q already exists", peer.Name)
+	}
+	if _, ok := b.Groups[peer.Name]; ok {
+		return fmt.Errorf("%q is already a group", peer.Name)
+	}
+	if _, _, err := SplitAddress(peer.Address, 1); err != nil || peer.Address == "" {
+		return fmt.Errorf("invalid address %q", peer.Address)
+	}
+	if peer.Fingerprint != "" && !fingerprintPattern.MatchString(peer.Fingerprint) {
+		return fmt.Errorf("invalid fingerprint %q (want sha256:<64 hex digits>)", peer.Fingerprint)
+	}
+	if b.Peers == nil {
+		b.Peers = make(map[string]Peer)
+	}
+	b.Peers[peer.Name] = peer
+	return nil
+}
+
+// SetGroup defines a group of existing peers, replacing any group of
+// the same name
+func (b *Book) SetGroup(name string, members []string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if _, ok := b.Peers[name]; ok {
+		return fmt.Errorf("%q is already a peer", name)
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("group %q has no members", name)
+	}
+	var unique []string
+	for _, member := range members {
+		if _, ok := b.Peers[member]; !ok {
+			return fmt.Errorf("no peer named %q", member)
+		}
+		if !slices.Contains(unique, member) {
+			unique = append(unique, member)
+		}
+	}
+	if b.Groups == nil {
+		b.Groups = make(map[string][]string)
+	}
+	b.Groups[name] = unique
+	return nil
+}
+
+// Remove removes the peer or group called name. A removed peer leaves
+// every group, and groups left empty are removed too.
+func (b *Book) Remove(name string) error {
+	if _, ok := b.Groups[name]; ok {
+		delete(b.Groups, name)
+		return nil
+	}
+	if _, ok := b.Peers[name]; !ok {
+		return fmt.Errorf("no peer or group named %q", name)
+	}
+	delete(b.Peers, name)
+	for group, members := range b.Groups {
+		members = slices.DeleteFunc(members, func(m string) bool { return m == name })
+		if len(members) == 0 {
+			delete(b.Groups, group)
+		} else {
+			b.Groups[group] = members
+		}
+	}
+	return nil
+}
+
+// List returns the peers sorted by name, only those tagged tag unless
+// tag is empty
+func (b *Book) List(tag string) []Peer {
+	var peers []Peer
+	for name, peer := range b.Peers {
+		if tag != "" && !slices.Contains(peer.Tags, tag) {
+			continue
+		}
+		peer.Name = name
+		peers = append(peers, peer)
+	}
+	slices.SortFunc(peers, func(a, b Peer) int { return cmp.Compare(a.Name, b.Name) })
+	return peers
+}
+
+// Resolve returns the peers a send target names: the peer itself or a
+// group's members. ok is false when target is neither.
+func (b *Book) Resolve(target string) (peers []Peer, ok bool) {
+	if peer, found := b.Peers[target]; found {
+		peer.Name = target
+		return []Peer{peer}, true
+	}
+	members, found := b.Groups[target]
+	if !found {
+		return nil, false
+	}
+	for _, name := range members {
+		peer := b.Peers[name]
+		peer.Name = name
+		peers = append(peers, peer)
+	}
+	return peers, true
+}
+
+// Discovered moves every peer whose fingerprint matches a sighting to
+// the sighted address and returns the changes, for a caller to Save. A
+// sighting without a port keeps the peer's port. Only peers recorded by
+// IP address move: nothing proves a sighting is a peer without a
+// fingerprint, and a host name is left to resolve by itself.
+func (b *Book) Discovered(sightings []Sighting) []Update {
+	var updates []Update
+	for _, peer := range b.List("") {
+		if peer.Fingerprint == "" || !hasIPAddress(peer.Address) {
+			continue
+		}
+		for _, s := range sightings {
+			if s.Fingerprint != peer.Fingerprint {
+				continue
+			}
+			moved := movedAddress(peer.Address, s.Address)
+			if moved != peer.Address {
+				updates = append(updates, Update{Name: peer.Name, Old: peer.Address, New: moved})
+				peer.Address = moved
+				b.Peers[peer.Name] = peer
+			}
+			break
+		}
+	}
+	return updates
+}
+
+// hasIPAddress reports whether address names its host by IP address
+func hasIPAddress(address string) bool {
+	host, _, err := SplitAddress(address, 0)
+	return err == nil && net.ParseIP(host) != nil
+}
+
+// movedAddress returns where a peer at old was seen, keeping old's port
+// when seen has none
+func movedAddress(old, seen string) string {
+	if _, _, err := net.SplitHostPort(seen); err == nil {
+		return seen
+	}
+	host := strings.Trim(seen, "[]")
+	if _, port, err := net.SplitHostPort(old); err == nil {
+		return net.JoinHostPort(host, port)
+	}
+	return host
+}
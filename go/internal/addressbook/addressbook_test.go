@@ -0,0 +1,181 @@
+package addressbook
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	laptopFingerprint = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	phoneFingerprint  = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+// testBook returns a book with a laptop, a phone and a group of both
+func testBook(t *testing.T) *Book {
+	t.Helper()
+	b, err := Load(filepath.Join(t.TempDir(), "peers.toml"))
+	if err != nil {
+		t.Fatalf("Failed to load missing book: %v", err)
+	}
+	for _, peer := range []Peer{
+		{Name: "laptop", Address: "192.168.1.20:8080", Fingerprint: laptopFingerprint, Tags: []string{"home"}},
+		{Name: "phone", Address: "192.168.1.30", Fingerprint: phoneFingerprint},
+		{Name: "printer", Address: "192.168.1.40:9000"},
+	} {
+		if err := b.Add(peer); err != nil {
+			t.Fatalf("Failed to add %s: %v", peer.Name, err)
+		}
+	}
+	if err := b.SetGroup("devices", []string{"laptop", "phone", "laptop"}); err != nil {
+		t.Fatalf("Failed to set group: %v", err)
+	}
+	return b
+}
+
+func names(peers []Peer) []string {
+	var names []string
+	for _, peer := range peers {
+		names = append(names, peer.Name)
+	}
+	return names
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	b := testBook(t)
+	if err := b.Save(); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	loaded, err := Load(b.Path)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if got := loaded.List(""); !slices.Equal(names(got), []string{"laptop", "phone", "printer"}) {
+		t.Errorf("Loaded peers %v", names(got))
+	}
+	if laptop := loaded.List("home"); len(laptop) != 1 || laptop[0].Address != "192.168.1.20:8080" || laptop[0].Fingerprint != laptopFingerprint {
+		t.Errorf("Loaded laptop = %+v", laptop)
+	}
+	if got := loaded.Groups["devices"]; !slices.Equal(got, []string{"laptop", "phone"}) {
+		t.Errorf("Loaded group = %v", got)
+	}
+	if info, err := os.Stat(b.Path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Book file mode = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestAddValidates(t *testing.T) {
+	b := testBook(t)
+	for _, peer := range []Peer{
+		{Name: "laptop", Address: "10.0.0.1"},
+		{Name: "devices", Address: "10.0.0.1"},
+		{Name: "a,b", Address: "10.0.0.1"},
+		{Name: "host:1", Address: "10.0.0.1"},
+		{Name: "nas", Address: ""},
+		{Name: "nas", Address: "10.0.0.1:99999"},
+		{Name: "nas", Address: "10.0.0.1", Fingerprint: "abc"},
+	} {
+		if err := b.Add(peer); err == nil {
+			t.Errorf("Add(%+v) accepted", peer)
+		}
+	}
+	if err := b.SetGroup("laptop", []string{"phone"}); err == nil {
+		t.Error("Group named after a peer accepted")
+	}
+	if err := b.SetGroup("others", []string{"tablet"}); err == nil {
+		t.Error("Group with an unknown member accepted")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	b := testBook(t)
+	if peers, ok := b.Resolve("printer"); !ok || !slices.Equal(names(peers), []string{"printer"}) {
+		t.Errorf("Resolve(printer) = %v, %v", names(peers), ok)
+	}
+	if peers, ok := b.Resolve("devices"); !ok || !slices.Equal(names(peers), []string{"laptop", "phone"}) || peers[1].Address != "192.168.1.30" {
+		t.Errorf("Resolve(devices) = %+v, %v", peers, ok)
+	}
+	if _, ok := b.Resolve("10.0.0.1"); ok {
+		t.Error("Address resolved as a name")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	b := testBook(t)
+	if err := b.Remove("laptop"); err != nil {
+		t.Fatalf("Failed to remove peer: %v", err)
+	}
+	if got := b.Groups["devices"]; !slices.Equal(got, []string{"phone"}) {
+		t.Errorf("Group after removing a member = %v", got)
+	}
+	if err := b.Remove("phone"); err != nil {
+		t.Fatalf("Failed to remove peer: %v", err)
+	}
+	if _, ok := b.Groups["devices"]; ok {
+		t.Error("Empty group kept")
+	}
+	if err := b.Remove("phone"); err == nil || !strings.Contains(err.Error(), "phone") {
+		t.Errorf("Removing a missing peer returned %v", err)
+	}
+}
+
+func TestDiscovered(t *testing.T) {
+	b := testBook(t)
+	if err := b.Add(Peer{Name: "nas", Address: "nas.local:9000", Fingerprint: "sha256:4444444444444444444444444444444444444444444444444444444444444444"}); err != nil {
+		t.Fatalf("Failed to add nas: %v", err)
+	}
+	updates := b.Discovered([]Sighting{
+		{Fingerprint: laptopFingerprint, Address: "192.168.1.99:8080"},
+		{Fingerprint: phoneFingerprint, Address: "192.168.1.31"},
+		{Fingerprint: "sha256:3333333333333333333333333333333333333333333333333333333333333333", Address: "192.168.1.40:9000"},
+		{Fingerprint: "sha256:4444444444444444444444444444444444444444444444444444444444444444", Address: "192.168.1.50:9000"},
+	})
+	want := []Update{
+		{Name: "laptop", Old: "192.168.1.20:8080", New: "192.168.1.99:8080"},
+		{Name: "phone", Old: "192.168.1.30", New: "192.168.1.31"},
+	}
+	if !slices.Equal(updates, want) {
+		t.Errorf("Updates = %+v, want %+v", updates, want)
+	}
+	if peers, _ := b.Resolve("laptop"); peers[0].Address != "192.168.1.99:8080" || peers[0].Fingerprint != laptopFingerprint {
+		t.Errorf("Laptop after discovery = %+v", peers[0])
+	}
+	if peers, _ := b.Resolve("printer"); peers[0].Address != "192.168.1.40:9000" {
+		t.Errorf("Peer without a fingerprint moved to %s", peers[0].Address)
+	}
+	if peers, _ := b.Resolve("nas"); peers[0].Address != "nas.local:9000" {
+		t.Errorf("Peer recorded by name moved to %s", peers[0].Address)
+	}
+
+	// A sender is seen without its port, which the peer keeps
+	updates = b.Discovered([]Sighting{{Fingerprint: laptopFingerprint, Address: "192.168.1.100"}})
+	if len(updates) != 1 || updates[0].New != "192.168.1.100:8080" {
+		t.Errorf("Host-only sighting gave %+v", updates)
+	}
+	if updates := b.Discovered([]Sighting{{Fingerprint: laptopFingerprint, Address: "192.168.1.100"}}); len(updates) != 0 {
+		t.Errorf("Unchanged address reported as %+v", updates)
+	}
+}
+
+func TestSplitAddress(t *testing.T) {
+	for address, want := range map[string]struct {
+		host string
+		port int
+	}{
+		"example.com":      {"example.com", 8080},
+		"example.com:9000": {"example.com", 9000},
+		"[::1]:9000":       {"::1", 9000},
+		"::1":              {"::1", 8080},
+		"[::1]":            {"::1", 8080},
+	} {
+		host, port, err := SplitAddress(address, 8080)
+		if err != nil || host != want.host || port != want.port {
+			t.Errorf("SplitAddress(%q) = %q, %d, %v", address, host, port, err)
+		}
+	}
+	if _, _, err := SplitAddress("example.com:http", 8080); err == nil {
+		t.Error("Named port accepted")
+	}
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"secure-transfer/internal/addressbook"
+	"secure-transfer/internal/transfer"
+)
+
+// maxRequestBody bounds the JSON accepted by POST /send
+const maxRequestBody = 16 * 1024 * 1024
+
+// SendFunc delivers message to the echo daemon or daemons at target
+type SendFunc func(ctx context.Context, target, message string) error
+
+// Server is the local HTTP API of the echo daemon. It only accepts
+// requests from loopback addresses carrying the bearer token.
+type Server struct {
+	// Token authenticates requests
+	Token string
+
+	// Send delivers messages for POST /send
+	Send SendFunc
+
+	// History answers GET /history
+	History *transfer.History
+
+	// Peers loads the address book for GET /peers
+	Peers func() (*addressbook.Book, error)
+
+	Logger *slog.Logger
+}
+
+// SendRequest is the body of POST /send
+type SendRequest struct {
+	// Target is the receiver as host, host:port, or an address book peer
+	// or group name
+	Target string `json:"target"`
+
+	Message string `json:"message"`
+}
+
+// PeerInfo describes an address book peer in GET /peers
+type PeerInfo struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+
+	// Fingerprint is the identity the peer must prove, if recorded
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	// Groups are the groups the peer is a member of
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Handler returns the API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /send", s.handleSend)
+	mux.HandleFunc("GET /history", s.handleHistory)
+	mux.HandleFunc("GET /peers", s.handlePeers)
+	return s.authenticate(mux)
+}
+
+// Listen listens on addr, refusing addresses reachable from other machines
+func Listen(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopback(listener.Addr().String()) {
+		listener.Close()
+		return nil, fmt.Errorf("API address %s is not a loopback address", addr)
+	}
+	return listener, nil
+}
+
+// Serve serves the API on listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	return http.Serve(listener, s.Handler())
+}
+
+// authenticate rejects requests that are not local or lack the token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopback(r.RemoteAddr) {
+			writeError(w, http.StatusForbidden, errors.New("API only accepts local requests"))
+			return
+		}
+		// A loopback Host guards against DNS rebinding from web pages
+		if !isLoopbackHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("unexpected host %q", r.Host))
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong API token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req SendRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("malformed request: %w", err))
+		return
+	}
+	if req.Target == "" {
+		writeError(w, http.StatusBadRequest, errors.New("target is required"))
+		return
+	}
+
+	if err := s.Send(r.Context(), req.Target, req.Message); err != nil {
+		s.Logger.Warn("API send failed", "target", req.Target, "error", err)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	s.Logger.Info("API message sent", "target", req.Target, "bytes", len(req.Message))
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if text := r.URL.Query().Get("limit"); text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", text))
+			return
+		}
+		limit = n
+	}
+	items := []transfer.Received{}
+	if s.History != nil {
+		items = s.History.Recent(limit)
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	book, err := s.Peers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	peers := book.List("")
+	infos := make([]PeerInfo, 0, len(peers))
+	for _, peer := range peers {
+		info := PeerInfo{Name: peer.Name, Address: peer.Address, Fingerprint: peer.Fingerprint, Tags: peer.Tags}
+		for group, members := range book.Groups {
+			if slices.Contains(members, peer.Name) {
+				info.Groups = append(info.Groups, group)
+			}
+		}
+		slices.Sort(info.Groups)
+		infos = append(infos, info)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// isLoopback reports whether a host:port address is on the loopback interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopbackHost reports whether a Host header names the local machine
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// LoadOrCreateToken reads the API token at path, generating a random one
+// readable only by the owner if the file does not exist
+func LoadOrCreateToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("API token file %s is empty", path)
+		}
+		return token, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"secure-transfer/internal/addressbook"
+	"secure-transfer/internal/transfer"
+)
+
+const (
+	testToken       = "secret-token"
+	testFingerprint = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+)
+
+type sent struct {
+	target, message string
+}
+
+// testLogger returns a logger discarding everything tests log
+func testLogger(t *testing.T) *slog.Logger {
+	t.Helper()
+	return slog.New(slog.DiscardHandler)
+}
+
+func newTestServer(t *testing.T) (*Server, *[]sent) {
+	t.Helper()
+	var calls []sent
+	book, _ := addressbook.Load(filepath.Join(t.TempDir(), "peers.toml"))
+	book.Add(addressbook.Peer{Name: "laptop", Address: "192.168.1.20:8080", Fingerprint: testFingerprint})
+	book.Add(addressbook.Peer{Name: "printer", Address: "192.168.1.40"})
+	book.SetGroup("team", []string{"laptop"})
+	return &Server{
+		Token: testToken,
+		Send: func(ctx context.Context, target, message string) error {
+			if target == "unreachable:1" {
+				return errors.New("connection refused")
+			}
+			calls = append(calls, sent{target, message})
+			return nil
+		},
+		History: transfer.NewHistory(10),
+		Peers: func() (*addressbook.Book, error) {
+			return book, nil
+		},
+		Logger: testLogger(t),
+	}, &calls
+}
+
+func request(t *testing.T, s *Server, method, path, body string, mutate func(*http.Request)) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "http://127.0.0.1:8765"+path, strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:50000"
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if mutate != nil {
+		mutate(req)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSend(t *testing.T) {
+	s, calls := newTestServer(t)
+
+	rec := request(t, s, "POST", "/send", `{"target":"10.0.0.5:8080","message":"selection"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /send = %d: %s", rec.Code, rec.Body)
+	}
+	if len(*calls) != 1 || (*calls)[0] != (sent{"10.0.0.5:8080", "selection"}) {
+		t.Errorf("Send called with %v", *calls)
+	}
+
+	if rec := request(t, s, "POST", "/send", `{"message":"x"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Missing target = %d, want 400", rec.Code)
+	}
+	if rec := request(t, s, "POST", "/send", `{"target":"unreachable:1"}`, nil); rec.Code != http.StatusBadGateway {
+		t.Errorf("Failed delivery = %d, want 502", rec.Code)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	testCases := []struct {
+		name   string
+		mutate func(*http.Request)
+		want   int
+	}{
+		{"No token", func(r *http.Request) { r.Header.Del("Authorization") }, http.StatusUnauthorized},
+		{"Wrong token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		{"Remote client", func(r *http.Request) { r.RemoteAddr = "192.0.2.7:50000" }, http.StatusForbidden},
+		{"Rebound host", func(r *http.Request) { r.Host = "evil.example:8765" }, http.StatusForbidden},
+		{"Localhost name", func(r *http.Request) { r.Host = "localhost:8765" }, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := request(t, s, "GET", "/peers", "", tc.mutate); rec.Code != tc.want {
+				t.Errorf("Status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestPeersAndHistory(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	var peers []PeerInfo
+	json.Unmarshal(request(t, s, "GET", "/peers", "", nil).Body.Bytes(), &peers)
+	want := []PeerInfo{
+		{Name: "laptop", Address: "192.168.1.20:8080", Fingerprint: testFingerprint, Groups: []string{"team"}},
+		{Name: "printer", Address: "192.168.1.40"},
+	}
+	if !reflect.DeepEqual(peers, want) {
+		t.Errorf("Peers = %+v, want %+v", peers, want)
+	}
+
+	var history []transfer.Received
+	rec := request(t, s, "GET", "/history?limit=5", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil || len(history) != 0 {
+		t.Errorf("Empty history = %s", rec.Body)
+	}
+	if rec := request(t, s, "GET", "/history?limit=-1", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Negative limit = %d, want 400", rec.Code)
+	}
+}
+
+func TestLoadOrCreateToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.token")
+	first, err := LoadOrCreateToken(path)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	second, err := LoadOrCreateToken(path)
+	if err != nil || second != first {
+		t.Errorf("Token was not reused: %q, %v", second, err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Token file permissions = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestListenRejectsPublicAddress(t *testing.T) {
+	if _, err := Listen("0.0.0.0:0"); err == nil {
+		t.Error("Listening on all interfaces accepted")
+	}
+	listener, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Loopback listener refused: %v", err)
+	}
+	listener.Close()
+}
@@ -0,0 +1,259 @@
+package approval
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"secure-transfer/internal/transfer"
+)
+
+// Frontends received items can be approved from
+const (
+	FrontendTerminal = "terminal"
+	FrontendNotify   = "notify"
+	FrontendControl  = "control"
+)
+
+// ValidateFrontends checks every name is a known frontend
+func ValidateFrontends(names []string) error {
+	for _, name := range names {
+		switch name {
+		case FrontendTerminal, FrontendNotify, FrontendControl:
+		default:
+			return fmt.Errorf("unknown approval frontend %q (want terminal, notify or control)", name)
+		}
+	}
+	return nil
+}
+
+// ErrNotPending means no item with the given ID is awaiting a decision
+var ErrNotPending = errors.New("no such pending item")
+
+// Prompter asks the user about a pending item and reports the answer with
+// decide. ctx is cancelled once the item is decided elsewhere or expires.
+type Prompter interface {
+	Prompt(ctx context.Context, item transfer.Pending, decide func(accept bool))
+}
+
+// Queue holds received items until a prompter or Decide accepts or
+// rejects them. It implements transfer.Approver.
+type Queue struct {
+	timeout   time.Duration
+	prompters []Prompter
+	logger    *slog.Logger
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*entry
+}
+
+type entry struct {
+	item     transfer.Pending
+	decision chan bool
+}
+
+// NewQueue returns a queue that asks prompters about every item and
+// rejects items nobody decides on within timeout
+func NewQueue(timeout time.Duration, logger *slog.Logger, prompters ...Prompter) *Queue {
+	return &Queue{
+		timeout:   timeout,
+		prompters: prompters,
+		logger:    logger,
+		pending:   make(map[uint64]*entry),
+	}
+}
+
+// Approve holds item until it is decided or times out
+func (q *Queue) Approve(item transfer.Pending) bool {
+	q.mu.Lock()
+	q.nextID++
+	item.ID = q.nextID
+	e := &entry{item: item, decision: make(chan bool, 1)}
+	q.pending[item.ID] = e
+	q.mu.Unlock()
+
+	q.logger.Info("Holding received item for approval", "id", item.ID, "type", item.Type,
+		"identity", item.Sender(), "bytes", item.Size)
+	ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+	defer cancel()
+	for _, p := range q.prompters {
+		go p.Prompt(ctx, item, func(accept bool) { q.Decide(item.ID, accept) })
+	}
+
+	select {
+	case accept := <-e.decision:
+		q.logger.Info("Received item decided", "id", item.ID, "accepted", accept)
+		return accept
+	case <-ctx.Done():
+		q.remove(item.ID)
+		q.logger.Warn("No decision on received item, rejecting", "id", item.ID, "timeout", q.timeout)
+		return false
+	}
+}
+
+// Pending returns the items awaiting a decision, oldest first
+func (q *Queue) Pending() []transfer.Pending {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]transfer.Pending, 0, len(q.pending))
+	for _, e := range q.pending {
+		items = append(items, e.item)
+	}
+	slices.SortFunc(items, func(a, b transfer.Pending) int { return cmp.Compare(a.ID, b.ID) })
+	return items
+}
+
+// Decide accepts or rejects a pending item. Only the first decision on
+// an item counts.
+func (q *Queue) Decide(id uint64, accept bool) error {
+	e := q.remove(id)
+	if e == nil {
+		return fmt.Errorf("%w %d", ErrNotPending, id)
+	}
+	e.decision <- accept
+	return nil
+}
+
+// remove takes an item out of the queue, returning nil if it was not there
+func (q *Queue) remove(id uint64) *entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.pending[id]
+	if !ok {
+		return nil
+	}
+	delete(q.pending, id)
+	return e
+}
+
+// describe returns a one-line summary of an item
+func describe(item transfer.Pending) string {
+	return fmt.Sprintf("%s from %s (%s), %d bytes", item.Type, item.Sender(), item.Remote, item.Size)
+}
+
+// Terminal asks on a terminal, one item at a time
+type Terminal struct {
+	out io.Writer
+
+	// lines carries the answers typed, closed at the end of the input
+	lines chan string
+
+	mu sync.Mutex
+	// stale is set when a prompt ended unanswered, as the answer the user
+	// may already be typing was meant for it
+	stale bool
+}
+
+// NewTerminal returns a prompter reading answers from in. A single
+// goroutine reads in for the lifetime of the prompter, so a prompt for
+// an item decided elsewhere does not leave a read behind.
+func NewTerminal(in io.Reader, out io.Writer) *Terminal {
+	t := &Terminal{out: out, lines: make(chan string, 1)}
+	go t.read(in)
+	return t
+}
+
+// read passes the lines of in to prompts
+func (t *Terminal) read(in io.Reader) {
+	defer close(t.lines)
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			t.lines <- line
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Prompt shows item and waits for a y or n line
+func (t *Terminal) Prompt(ctx context.Context, item transfer.Pending, decide func(accept bool)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Decided elsewhere while an earlier prompt was waiting
+	if ctx.Err() != nil {
+		return
+	}
+	if t.stale {
+		t.drain()
+		t.stale = false
+	}
+
+	fmt.Fprintf(t.out, "\n[%d] Incoming %s\n    %s\nAccept? [y/N] ", item.ID, describe(item), item.Preview)
+	select {
+	case line, ok := <-t.lines:
+		if !ok {
+			// No terminal to answer from, leave it to other frontends
+			return
+		}
+		answer := strings.ToLower(strings.TrimSpace(line))
+		decide(answer == "y" || answer == "yes")
+	case <-ctx.Done():
+		t.stale = true
+		fmt.Fprintf(t.out, "\nItem %d was already decided\n", item.ID)
+	}
+}
+
+// drain discards the lines typed so far
+func (t *Terminal) drain() {
+	for {
+		select {
+		case _, ok := <-t.lines:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// NotifySend asks with a desktop notification offering Accept and Reject
+// actions, using notify-send from libnotify 0.7.10 or later
+type NotifySend struct {
+	// Command is the notify-send executable; "notify-send" when empty
+	Command string
+
+	Logger *slog.Logger
+}
+
+// Prompt shows a notification and waits for one of its actions
+func (n NotifySend) Prompt(ctx context.Context, item transfer.Pending, decide func(accept bool)) {
+	command := n.Command
+	if command == "" {
+		command = "notify-send"
+	}
+	cmd := exec.CommandContext(ctx, command,
+		"--app-name=secure-transfer",
+		"--wait",
+		"--action=accept=Accept",
+		"--action=reject=Reject",
+		"Incoming "+item.Type+" from "+item.Sender(),
+		fmt.Sprintf("%d bytes from %s\n%s", item.Size, item.Remote, item.Preview))
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		n.Logger.Warn("Could not show approval notification", "error", err)
+		return
+	}
+	switch strings.TrimSpace(string(out)) {
+	case "accept":
+		decide(true)
+	case "reject":
+		decide(false)
+	}
+}
@@ -0,0 +1,155 @@
+package approval
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"secure-transfer/internal/transfer"
+)
+
+// testLogger returns a logger discarding everything tests log
+func testLogger(t *testing.T) *slog.Logger {
+	t.Helper()
+	return slog.New(slog.DiscardHandler)
+}
+
+func TestQueueDecide(t *testing.T) {
+	q := NewQueue(time.Minute, testLogger(t))
+
+	result := make(chan bool, 1)
+	go func() { result <- q.Approve(transfer.Pending{Type: "message", Size: 5, Preview: "hello"}) }()
+
+	var pending []transfer.Pending
+	for range 100 {
+		if pending = q.Pending(); len(pending) == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(pending) != 1 || pending[0].Preview != "hello" {
+		t.Fatalf("Pending = %+v", pending)
+	}
+	if err := q.Decide(pending[0].ID, true); err != nil {
+		t.Fatalf("Decide failed: %v", err)
+	}
+	if !<-result {
+		t.Error("Accepted item was rejected")
+	}
+	if err := q.Decide(pending[0].ID, false); !errors.Is(err, ErrNotPending) {
+		t.Errorf("Second decision = %v, want ErrNotPending", err)
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	q := NewQueue(20*time.Millisecond, testLogger(t))
+	if q.Approve(transfer.Pending{Type: "file"}) {
+		t.Error("Undecided item was accepted")
+	}
+	if len(q.Pending()) != 0 {
+		t.Error("Expired item still pending")
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	var out bytes.Buffer
+	q := NewQueue(time.Minute, testLogger(t), NewTerminal(strings.NewReader("y\nno\n"), &out))
+
+	if !q.Approve(transfer.Pending{Type: "message", Peer: "laptop", Size: 2, Preview: "hi"}) {
+		t.Error("Answer y rejected the item")
+	}
+	if q.Approve(transfer.Pending{Type: "message", Peer: "laptop", Size: 2, Preview: "hi"}) {
+		t.Error("Answer no accepted the item")
+	}
+	if !strings.Contains(out.String(), "message from laptop") || !strings.Contains(out.String(), "Accept? [y/N]") {
+		t.Errorf("Prompt output %q", out.String())
+	}
+}
+
+// readUntil reads r until text appears
+func readUntil(t *testing.T, r *bufio.Reader, text string) {
+	t.Helper()
+	var read []byte
+	for !bytes.Contains(read, []byte(text)) {
+		b, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("Output ended before %q: %q", text, read)
+		}
+		read = append(read, b)
+	}
+}
+
+func TestTerminalItemDecidedElsewhere(t *testing.T) {
+	in, typed := io.Pipe()
+	shown, out := io.Pipe()
+	defer typed.Close()
+	defer out.Close()
+	screen := bufio.NewReader(shown)
+	term := NewTerminal(in, out)
+	q := NewQueue(time.Minute, testLogger(t), term)
+
+	result := make(chan bool, 1)
+	go func() { result <- q.Approve(transfer.Pending{Type: "message", Size: 5}) }()
+	readUntil(t, screen, "Accept? [y/N] ")
+	if err := q.Decide(q.Pending()[0].ID, false); err != nil {
+		t.Fatalf("Decide failed: %v", err)
+	}
+	<-result
+	readUntil(t, screen, "already decided")
+
+	// The answer meant for the decided item arrives late
+	io.WriteString(typed, "y\n")
+	for len(term.lines) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	go func() { result <- q.Approve(transfer.Pending{Type: "message", Size: 5}) }()
+	readUntil(t, screen, "Accept? [y/N] ")
+	io.WriteString(typed, "n\n")
+	if <-result {
+		t.Error("Answer typed for a decided item accepted the next one")
+	}
+}
+
+func TestNotifySend(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake notify-send is a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "notify-send")
+	os.WriteFile(script, []byte("#!/bin/sh\necho reject\n"), 0755)
+
+	q := NewQueue(time.Minute, testLogger(t), NotifySend{Command: script, Logger: testLogger(t)})
+	if q.Approve(transfer.Pending{Type: "file", Size: 10}) {
+		t.Error("Reject action accepted the item")
+	}
+}
+
+func TestValidateFrontends(t *testing.T) {
+	if err := ValidateFrontends([]string{"terminal", "control"}); err != nil {
+		t.Errorf("Valid frontends refused: %v", err)
+	}
+	if err := ValidateFrontends([]string{"email"}); err == nil {
+		t.Error("Unknown frontend accepted")
+	}
+}
+
+func TestPromptSkipsDecidedItems(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var out bytes.Buffer
+	NewTerminal(strings.NewReader("y\n"), &out).Prompt(ctx, transfer.Pending{}, func(bool) {
+		t.Error("Decided an item that was no longer pending")
+	})
+	if out.Len() != 0 {
+		t.Errorf("Prompted for a decided item: %q", out.String())
+	}
+}
@@ -0,0 +1,228 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Actions recorded for a received item
+const (
+	ActionSaved     = "saved"
+	ActionClipboard = "clipboard"
+	ActionRejected  = "rejected"
+)
+
+// Entry is one received item. Each entry carries the hash of the previous
+// one, so editing, reordering or removing an entry breaks the chain.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Remote      string    `json:"remote"`
+	Peer        string    `json:"peer,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	SessionID   string    `json:"session_id"`
+	Type        string    `json:"type"`
+	Size        int       `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Actions     []string  `json:"actions"`
+	Path        string    `json:"path,omitempty"`
+
+	// Prev is the hash of the previous entry, empty for the first
+	Prev string `json:"prev"`
+
+	// Hash covers every other field, including Prev
+	Hash string `json:"hash,omitempty"`
+}
+
+// ContentHash returns the hex SHA-256 of received content
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// computeHash returns the hash of e with its Hash field cleared
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends entries to a hash-chained JSON lines file. Only one Log
+// should write to a file at a time.
+type Log struct {
+	path string
+
+	// dropped is the size of an interrupted append removed by Open
+	dropped int
+
+	mu   sync.Mutex
+	last string
+}
+
+// Open opens the audit log at path, creating it if needed, and continues
+// the chain from its last entry. An append cut short by a crash leaves a
+// partial last line; its entry was never acknowledged, so Open removes it
+// and continues from the entry before. Any other malformed entry is an
+// error.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	l := &Log{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if tail := bytes.TrimSpace(data[complete:]); len(tail) > 0 {
+		if json.Valid(tail) {
+			// A whole entry only missing its newline, which the next
+			// append would run into
+			err = appendNewline(path)
+		} else {
+			err = os.Truncate(path, int64(complete))
+			l.dropped = len(data) - complete
+			data = data[:complete]
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error repairing the end of audit log %s: %w", path, err)
+		}
+	}
+
+	err = readEntries(bytes.NewReader(data), func(_ int, e Entry) error {
+		l.last = e.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit log %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Dropped returns the size in bytes of the interrupted append Open
+// removed, or 0
+func (l *Log) Dropped() int {
+	return l.dropped
+}
+
+// appendNewline ends the last line of the file at path
+func appendNewline(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte{'\n'}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Append chains e to the log and writes it to disk before returning
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Time = e.Time.UTC()
+	e.Prev = l.last
+	hash, err := e.computeHash()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	l.last = hash
+	return nil
+}
+
+// ChainError reports the first entry at which verification failed
+type ChainError struct {
+	Line   int
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit log line %d: %s", e.Line, e.Reason)
+}
+
+// Verify checks every entry's hash and link to its predecessor. It
+// returns the number of entries and the hash of the last one, which can be
+// recorded elsewhere to also detect truncation.
+func Verify(r io.Reader) (int, string, error) {
+	count, last := 0, ""
+	err := readEntries(r, func(line int, e Entry) error {
+		if e.Prev != last {
+			return &ChainError{Line: line, Reason: "does not follow the previous entry"}
+		}
+		hash, err := e.computeHash()
+		if err != nil {
+			return err
+		}
+		if hash != e.Hash {
+			return &ChainError{Line: line, Reason: "content does not match its hash"}
+		}
+		count++
+		last = e.Hash
+		return nil
+	})
+	return count, last, err
+}
+
+// readEntries decodes the log line by line
+func readEntries(r io.Reader, fn func(line int, e Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(text, &e); err != nil {
+			return &ChainError{Line: line, Reason: "malformed entry: " + err.Error()}
+		}
+		if err := fn(line, e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
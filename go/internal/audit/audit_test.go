@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeEntries(t *testing.T, path string, n int) {
+	t.Helper()
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	for i := range n {
+		data := []byte(strings.Repeat("x", i+1))
+		err := log.Append(Entry{
+			Time:        time.Now(),
+			Remote:      "192.0.2.1:5000",
+			Fingerprint: "sha256:abcd",
+			Type:        "message",
+			Size:        len(data),
+			SHA256:      ContentHash(data),
+			Actions:     []string{ActionClipboard},
+		})
+		if err != nil {
+			t.Fatalf("Failed to append entry: %v", err)
+		}
+	}
+}
+
+func verifyFile(t *testing.T, path string) (int, error) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	count, _, err := Verify(f)
+	return count, err
+}
+
+func TestChainSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeEntries(t, path, 2)
+	writeEntries(t, path, 2)
+
+	count, err := verifyFile(t, path)
+	if err != nil {
+		t.Fatalf("Intact log failed verification: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("Verified %d entries, want 4", count)
+	}
+
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Audit log permissions = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "audit.log")
+	writeEntries(t, original, 3)
+	data, _ := os.ReadFile(original)
+	lines := bytes.SplitAfter(bytes.TrimSpace(data), []byte("\n"))
+
+	testCases := []struct {
+		name   string
+		edit   func() []byte
+		atLine int
+	}{
+		{"Edited size", func() []byte {
+			return bytes.Replace(data, []byte(`"size":2`), []byte(`"size":9`), 1)
+		}, 2},
+		{"Removed entry", func() []byte {
+			return bytes.Join([][]byte{lines[0], lines[2]}, nil)
+		}, 2},
+		{"Reordered entries", func() []byte {
+			return bytes.Join([][]byte{lines[1], lines[0], lines[2]}, nil)
+		}, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := Verify(bytes.NewReader(tc.edit()))
+			var chainErr *ChainError
+			if !errors.As(err, &chainErr) {
+				t.Fatalf("Tampered log verified: %v", err)
+			}
+			if chainErr.Line != tc.atLine {
+				t.Errorf("Failure reported at line %d, want %d", chainErr.Line, tc.atLine)
+			}
+		})
+	}
+}
+
+func TestOpenRejectsMalformedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	os.WriteFile(path, []byte("not json\n"), 0600)
+	_, err := Open(path)
+	var chainErr *ChainError
+	if !errors.As(err, &chainErr) || chainErr.Line != 1 {
+		t.Errorf("Malformed audit log opened with %v", err)
+	}
+}
+
+func TestOpenDropsInterruptedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeEntries(t, path, 2)
+	intact, _ := os.ReadFile(path)
+
+	// A crash while appending the third entry left half of it
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"time":"2025-06-01T12:00:00Z","remote":"192.0.2.1:50`)
+	f.Close()
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log with a partial last line: %v", err)
+	}
+	if log.Dropped() == 0 {
+		t.Error("Dropped partial entry not reported")
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, intact) {
+		t.Errorf("Partial entry left in the log:\n%s", data)
+	}
+	writeEntries(t, path, 1)
+	if count, err := verifyFile(t, path); err != nil || count != 3 {
+		t.Errorf("Verify after recovery = %d, %v", count, err)
+	}
+}
+
+func TestOpenCompletesLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeEntries(t, path, 1)
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.TrimSuffix(data, []byte("\n")), 0600)
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log without a final newline: %v", err)
+	}
+	if log.Dropped() != 0 {
+		t.Errorf("Complete entry dropped: %d bytes", log.Dropped())
+	}
+	writeEntries(t, path, 1)
+	if count, err := verifyFile(t, path); err != nil || count != 2 {
+		t.Errorf("Verify after completing the last line = %d, %v", count, err)
+	}
+}
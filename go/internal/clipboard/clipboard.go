@@ -1,6 +1,7 @@
 package clipboard
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -8,8 +9,18 @@ import (
 	"runtime"
 )
 
+// ErrUnavailable wraps every failure to copy to the clipboard
+var ErrUnavailable = errors.New("clipboard unavailable")
+
 // CopyToClipboard copies text to clipboard based on platform
 func CopyToClipboard(text string) error {
+	if err := copyToClipboard(text); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return nil
+}
+
+func copyToClipboard(text string) error {
 	var cmd *exec.Cmd
 
 	// Check if running on Android via Termux
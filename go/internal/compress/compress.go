@@ -0,0 +1,173 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms understood by the transfer protocol
+const (
+	Auto = "auto"
+	Zstd = "zstd"
+	Gzip = "gzip"
+	None = "none"
+)
+
+// Supported lists the algorithms this build can decode, in preference order
+var Supported = []string{Zstd, Gzip, None}
+
+// ParseMode validates a --compress value
+func ParseMode(mode string) (string, error) {
+	switch mode {
+	case Auto, Zstd, Gzip, None:
+		return mode, nil
+	case "":
+		return Auto, nil
+	default:
+		return "", fmt.Errorf("unknown compression mode %q (want auto, zstd, gzip or none)", mode)
+	}
+}
+
+// Offer returns the algorithms a sender proposes for data in the given mode.
+// In auto mode content that is already compressed is only offered as none.
+func Offer(mode string, data []byte) []string {
+	switch mode {
+	case Zstd, Gzip:
+		return []string{mode, None}
+	case None:
+		return []string{None}
+	default:
+		if IsCompressed(data) {
+			return []string{None}
+		}
+		return Supported
+	}
+}
+
+// Select picks the first offered algorithm this side supports
+func Select(offers []string) (string, error) {
+	for _, offer := range offers {
+		for _, algo := range Supported {
+			if offer == algo {
+				return algo, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no common compression algorithm in %v", offers)
+}
+
+// Compress encodes data with the given algorithm
+func Compress(algo string, data []byte) ([]byte, error) {
+	switch algo {
+	case None:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer enc.Close()
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %q", algo)
+	}
+}
+
+// ErrTooLarge is returned when decompressed data would exceed the limit
+var ErrTooLarge = errors.New("decompressed data exceeds size limit")
+
+// Decompress decodes data that was encoded with the given algorithm,
+// refusing to produce more than limit bytes when limit is positive
+func Decompress(algo string, data []byte, limit int) ([]byte, error) {
+	var r io.Reader
+	switch algo {
+	case None:
+		if limit > 0 && len(data) > limit {
+			return nil, ErrTooLarge
+		}
+		return data, nil
+	case Gzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	case Zstd:
+		dec, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		r = dec
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %q", algo)
+	}
+
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	// Read one byte past the limit to tell "exactly limit" from "more"
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
+
+// compressedMagic holds signatures of container formats that do not shrink further
+var compressedMagic = [][]byte{
+	{0x1f, 0x8b},                       // gzip
+	{0x28, 0xb5, 0x2f, 0xfd},           // zstd
+	{'B', 'Z', 'h'},                    // bzip2
+	{0xfd, '7', 'z', 'X', 'Z', 0x00},   // xz
+	{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, // 7z
+	{'P', 'K', 0x03, 0x04},             // zip, jar, docx, apk
+	{'R', 'a', 'r', '!', 0x1a, 0x07},   // rar
+	{0x04, '"', 'M', 0x18},             // lz4
+	{0x89, 'P', 'N', 'G', '\r', '\n'},  // png
+	{0xff, 0xd8, 0xff},                 // jpeg
+	{'G', 'I', 'F', '8'},               // gif
+	{'O', 'g', 'g', 'S'},               // ogg
+	{'f', 'L', 'a', 'C'},               // flac
+	{0x1a, 0x45, 0xdf, 0xa3},           // matroska, webm
+}
+
+// IsCompressed reports whether data looks like an already-compressed format
+func IsCompressed(data []byte) bool {
+	for _, magic := range compressedMagic {
+		if bytes.HasPrefix(data, magic) {
+			return true
+		}
+	}
+	switch contentType := http.DetectContentType(data); {
+	case contentType == "image/bmp", contentType == "audio/wave":
+		return false
+	case strings.HasPrefix(contentType, "image/"),
+		strings.HasPrefix(contentType, "audio/"),
+		strings.HasPrefix(contentType, "video/"),
+		strings.HasPrefix(contentType, "font/woff"):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package compress
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 500)
+	random := make([]byte, 32*1024)
+	rand.Read(random)
+
+	for _, algo := range Supported {
+		for name, data := range map[string][]byte{"text": text, "random": random, "empty": {}} {
+			t.Run(algo+" "+name, func(t *testing.T) {
+				compressed, err := Compress(algo, data)
+				if err != nil {
+					t.Fatalf("Failed to compress: %v", err)
+				}
+				if name == "text" && algo != None && len(compressed) >= len(data) {
+					t.Errorf("Compressed text is not smaller: %d >= %d", len(compressed), len(data))
+				}
+
+				decompressed, err := Decompress(algo, compressed, 0)
+				if err != nil {
+					t.Fatalf("Failed to decompress: %v", err)
+				}
+				if !bytes.Equal(decompressed, data) {
+					t.Errorf("Decompressed data doesn't match original")
+				}
+			})
+		}
+	}
+}
+
+func TestOffer(t *testing.T) {
+	text := []byte("plain text that compresses well, plain text that compresses well")
+	gzipped, err := Compress(Gzip, text)
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	testCases := []struct {
+		name string
+		mode string
+		data []byte
+		want string
+	}{
+		{"Auto text", Auto, text, Zstd},
+		{"Auto gzip", Auto, gzipped, None},
+		{"Auto png", Auto, png, None},
+		{"Forced gzip", Gzip, gzipped, Gzip},
+		{"None", None, text, None},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Select(Offer(tc.mode, tc.data))
+			if err != nil {
+				t.Fatalf("Failed to select: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Selected %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelectNoCommonAlgorithm(t *testing.T) {
+	if _, err := Select([]string{"brotli"}); err == nil {
+		t.Error("Expected error for unsupported algorithm")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if _, err := ParseMode("lzma"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+	if mode, err := ParseMode(""); err != nil || mode != Auto {
+		t.Errorf("Empty mode should default to auto, got %q, %v", mode, err)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	// A small compressed input that expands far beyond the limit
+	bomb := make([]byte, 1024*1024)
+
+	for _, algo := range Supported {
+		t.Run(algo, func(t *testing.T) {
+			compressed, err := Compress(algo, bomb)
+			if err != nil {
+				t.Fatalf("Failed to compress: %v", err)
+			}
+			if _, err := Decompress(algo, compressed, 64*1024); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Got %v, want ErrTooLarge", err)
+			}
+			if out, err := Decompress(algo, compressed, len(bomb)); err != nil || len(out) != len(bomb) {
+				t.Errorf("Data exactly at the limit was refused: %v", err)
+			}
+		})
+	}
+}
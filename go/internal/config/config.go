@@ -0,0 +1,349 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"secure-transfer/internal/approval"
+	"secure-transfer/internal/compress"
+	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/logging"
+	"secure-transfer/internal/notify"
+	"secure-transfer/internal/transfer"
+
+	"github.com/BurntSushi/toml"
+)
+
+// EnvPrefix prefixes the environment variables overriding settings
+const EnvPrefix = "TRANSFER_"
+
+// Settings are the values a config file, profile or environment can supply.
+// Each TOML key maps to the command-line flag of the same name with dashes
+// and to the environment variable TRANSFER_<KEY>. Zero values are unset.
+type Settings struct {
+	IP        string   `toml:"ip,omitempty"`
+	Port      int      `toml:"port,omitempty"`
+	LogLevel  string   `toml:"log_level,omitempty"`
+	LogFormat string   `toml:"log_format,omitempty"`
+	LogFile   string   `toml:"log_file,omitempty"`
+	Transport string   `toml:"transport,omitempty"`
+	Cipher    string   `toml:"cipher,omitempty"`
+	Compress  string   `toml:"compress,omitempty"`
+	KeyFile   string   `toml:"key_file,omitempty"`
+	Clipboard string   `toml:"clipboard,omitempty"`
+	SaveDir   string   `toml:"save_dir,omitempty"`
+	Bind      string   `toml:"bind,omitempty"`
+	Allow     []string `toml:"allow,omitempty"`
+	Deny      []string `toml:"deny,omitempty"`
+
+	MaxConnections int     `toml:"max_connections,omitempty"`
+	Rate           float64 `toml:"rate,omitempty"`
+	Burst          int     `toml:"burst,omitempty"`
+	MaxSize        int     `toml:"max_size,omitempty"`
+
+	MetricsAddr string `toml:"metrics_addr,omitempty"`
+	AuditLog    string `toml:"audit_log,omitempty"`
+	APIAddr     string `toml:"api_addr,omitempty"`
+
+	Approve    []string `toml:"approve,omitempty"`
+	AutoAccept []string `toml:"auto_accept,omitempty"`
+
+	Notify string `toml:"notify,omitempty"`
+}
+
+// File is a parsed config file: top-level defaults plus named profiles
+// layered on top of them
+type File struct {
+	Settings
+	Profiles map[string]Settings `toml:"profiles,omitempty"`
+
+	// Path is where the file was read from
+	Path string `toml:"-"`
+
+	// unknown lists keys that matched no setting
+	unknown []string
+
+	// zeroPorts lists port keys set to 0, which would otherwise read as unset
+	zeroPorts []string
+}
+
+// Load reads a config file. A missing file yields empty settings.
+func Load(path string) (*File, error) {
+	f := &File{Path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := toml.Decode(string(data), f)
+	if err != nil {
+		return nil, fmt.Errorf("malformed config file %s: %w", path, err)
+	}
+	for _, key := range meta.Undecoded() {
+		f.unknown = append(f.unknown, key.String())
+	}
+	if meta.IsDefined("port") && f.Port == 0 {
+		f.zeroPorts = append(f.zeroPorts, "port")
+	}
+	for _, name := range f.ProfileNames() {
+		if meta.IsDefined("profiles", name, "port") && f.Profiles[name].Port == 0 {
+			f.zeroPorts = append(f.zeroPorts, "profiles."+name+".port")
+		}
+	}
+	return f, nil
+}
+
+// ProfileNames returns the profile names in sorted order
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the defaults overlaid with the named profile, or only the
+// defaults when name is empty. A port set to 0 in either is an error.
+func (f *File) Profile(name string) (Settings, error) {
+	settings := f.Settings
+	if name != "" {
+		profile, ok := f.Profiles[name]
+		if !ok {
+			return settings, fmt.Errorf("unknown profile %q in %s", name, f.Path)
+		}
+		settings.Merge(profile)
+	}
+	for _, key := range f.zeroPorts {
+		if key == "port" || key == "profiles."+name+".port" {
+			return settings, fmt.Errorf("%s 0 in %s outside 1-65535", key, f.Path)
+		}
+	}
+	return settings, nil
+}
+
+// Validate checks the defaults and every profile, reporting all problems
+func (f *File) Validate() error {
+	var errs []error
+	for _, key := range f.unknown {
+		errs = append(errs, fmt.Errorf("unknown key %q", key))
+	}
+	for _, key := range f.zeroPorts {
+		errs = append(errs, fmt.Errorf("%s 0 outside 1-65535", key))
+	}
+	if err := f.Settings.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, name := range f.ProfileNames() {
+		settings, _ := f.Profile(name)
+		if err := settings.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Merge overrides s with every setting that is set in other
+func (s *Settings) Merge(other Settings) {
+	dst := reflect.ValueOf(s).Elem()
+	src := reflect.ValueOf(other)
+	for i := range dst.NumField() {
+		if !src.Field(i).IsZero() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// ApplyEnv overrides s with the TRANSFER_<KEY> variables that are set
+func (s *Settings) ApplyEnv(getenv func(string) string) error {
+	for _, key := range Keys() {
+		text := getenv(EnvName(key))
+		if text == "" {
+			continue
+		}
+		if err := s.Set(key, text); err != nil {
+			return fmt.Errorf("%s: %w", EnvName(key), err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that every set value is one the tool accepts
+func (s Settings) Validate() error {
+	var errs []error
+	if s.Port < 0 || s.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d outside 1-65535", s.Port))
+	}
+	for _, limit := range []struct {
+		key   string
+		value float64
+	}{
+		{"max_connections", float64(s.MaxConnections)},
+		{"rate", s.Rate},
+		{"burst", float64(s.Burst)},
+		{"max_size", float64(s.MaxSize)},
+	} {
+		if limit.value < 0 {
+			errs = append(errs, fmt.Errorf("%s %v is negative", limit.key, limit.value))
+		}
+	}
+	if s.LogLevel != "" {
+		if _, err := logging.ParseLevel(s.LogLevel); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch s.LogFormat {
+	case "", logging.FormatText, logging.FormatJSON:
+	default:
+		errs = append(errs, fmt.Errorf("unknown log_format %q (want text or json)", s.LogFormat))
+	}
+	switch s.Transport {
+	case "", transfer.TransportTCP, transfer.TransportTLS:
+	default:
+		errs = append(errs, fmt.Errorf("unknown transport %q (want tcp or tls)", s.Transport))
+	}
+	if s.Cipher != "" {
+		if _, err := crypto.CipherByName(s.Cipher); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if s.Compress != "" {
+		if _, err := compress.ParseMode(s.Compress); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if s.Clipboard != "" {
+		if err := transfer.ValidateClipboardPolicy(s.Clipboard); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := transfer.ParseAccessList(s.Allow, s.Deny); err != nil {
+		errs = append(errs, err)
+	}
+	if err := approval.ValidateFrontends(s.Approve); err != nil {
+		errs = append(errs, err)
+	}
+	if s.Notify != "" {
+		if err := notify.Validate(s.Notify); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ExpandPaths replaces a leading ~ in path settings with the home directory
+func (s *Settings) ExpandPaths() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	for _, path := range []*string{&s.KeyFile, &s.SaveDir, &s.LogFile, &s.AuditLog} {
+		if *path == "~" {
+			*path = home
+		} else if rest, ok := strings.CutPrefix(*path, "~/"); ok {
+			*path = filepath.Join(home, rest)
+		}
+	}
+}
+
+// Keys returns the TOML keys of all settings in declaration order
+func Keys() []string {
+	t := reflect.TypeOf(Settings{})
+	keys := make([]string, t.NumField())
+	for i := range keys {
+		keys[i] = tomlKey(t.Field(i))
+	}
+	return keys
+}
+
+// FlagName returns the command-line flag for a TOML key
+func FlagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// EnvName returns the environment variable for a TOML key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// Get returns the value of key as flag text, or "" when unset. Lists are
+// joined with commas.
+func (s Settings) Get(key string) string {
+	field, ok := s.field(key)
+	if !ok || field.IsZero() {
+		return ""
+	}
+	switch field.Kind() {
+	case reflect.Int:
+		return strconv.Itoa(int(field.Int()))
+	case reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'g', -1, 64)
+	case reflect.Slice:
+		return strings.Join(field.Interface().([]string), ",")
+	default:
+		return field.String()
+	}
+}
+
+// Set parses text as flag text for key. Lists are split on commas.
+func (s *Settings) Set(key, text string) error {
+	field, ok := s.field(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	switch field.Kind() {
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", key, text)
+		}
+		// Zero reads as unset, so it would silently fall back to the default
+		if key == "port" && n == 0 {
+			return fmt.Errorf("port 0 outside 1-65535")
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", key, text)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		field.SetString(text)
+	}
+	return nil
+}
+
+// field returns the addressable struct field behind key
+func (s *Settings) field(key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(s).Elem()
+	for i := range v.NumField() {
+		if tomlKey(v.Type().Field(i)) == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// tomlKey returns the TOML key of a struct field
+func tomlKey(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+	return name
+}
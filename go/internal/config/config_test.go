@@ -0,0 +1,167 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = `
+port = 9000
+log_level = "warn"
+allow = ["10.0.0.0/8"]
+
+[profiles.laptop]
+ip = "192.168.1.20"
+key_file = "/etc/transfer/laptop.key"
+clipboard = "never"
+
+[profiles.nas]
+ip = "nas.local"
+port = 9100
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestProfileMerge(t *testing.T) {
+	f, err := Load(writeConfig(t, sample))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := f.Validate(); err != nil {
+		t.Fatalf("Valid config rejected: %v", err)
+	}
+
+	laptop, err := f.Profile("laptop")
+	if err != nil {
+		t.Fatalf("Failed to resolve profile: %v", err)
+	}
+	want := Settings{
+		IP:        "192.168.1.20",
+		Port:      9000,
+		LogLevel:  "warn",
+		KeyFile:   "/etc/transfer/laptop.key",
+		Clipboard: "never",
+		Allow:     []string{"10.0.0.0/8"},
+	}
+	if !reflect.DeepEqual(laptop, want) {
+		t.Errorf("Profile laptop = %+v, want %+v", laptop, want)
+	}
+
+	nas, _ := f.Profile("nas")
+	if nas.Port != 9100 {
+		t.Errorf("Profile port = %d, want 9100", nas.Port)
+	}
+
+	if _, err := f.Profile("missing"); err == nil {
+		t.Error("Unknown profile accepted")
+	}
+	if got := f.ProfileNames(); !reflect.DeepEqual(got, []string{"laptop", "nas"}) {
+		t.Errorf("ProfileNames() = %v", got)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	f, err := Load(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("Missing config file should not be an error: %v", err)
+	}
+	settings, err := f.Profile("")
+	if err != nil || !reflect.DeepEqual(settings, Settings{}) {
+		t.Errorf("Profile(\"\") = %+v, %v, want empty settings", settings, err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	settings := Settings{IP: "a.example", Port: 9000}
+	env := map[string]string{
+		"TRANSFER_IP":     "b.example",
+		"TRANSFER_DENY":   "10.0.0.1, 10.0.0.2",
+		"TRANSFER_CIPHER": "",
+	}
+	if err := settings.ApplyEnv(func(name string) string { return env[name] }); err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+	want := Settings{IP: "b.example", Port: 9000, Deny: []string{"10.0.0.1", "10.0.0.2"}}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("Settings = %+v, want %+v", settings, want)
+	}
+
+	env = map[string]string{"TRANSFER_PORT": "eighty"}
+	if err := settings.ApplyEnv(func(name string) string { return env[name] }); err == nil {
+		t.Error("Non-numeric TRANSFER_PORT accepted")
+	}
+	env = map[string]string{"TRANSFER_PORT": "0"}
+	if err := settings.ApplyEnv(func(name string) string { return env[name] }); err == nil {
+		t.Error("TRANSFER_PORT=0 accepted")
+	}
+}
+
+func TestGetSetRoundTrip(t *testing.T) {
+	var settings Settings
+	for key, value := range map[string]string{"port": "8443", "log_level": "debug", "rate": "0.5", "allow": "10.0.0.0/8,192.168.0.0/16"} {
+		if err := settings.Set(key, value); err != nil {
+			t.Fatalf("Set(%q) failed: %v", key, err)
+		}
+		if got := settings.Get(key); got != value {
+			t.Errorf("Get(%q) = %q, want %q", key, got, value)
+		}
+	}
+	if settings.Get("ip") != "" {
+		t.Error("Unset setting should read as empty")
+	}
+	if err := settings.Set("no_such_key", "x"); err == nil {
+		t.Error("Unknown setting accepted")
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	f, err := Load(writeConfig(t, `
+port = 70000
+colour = "blue"
+
+[profiles.bad]
+transport = "carrier-pigeon"
+clipboard = "sometimes"
+deny = ["not-an-address"]
+approve = ["carrier-pigeon-ack"]
+notify = "smoke-signal"
+burst = -1
+
+[profiles.zero]
+port = 0
+`))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	err = f.Validate()
+	if err == nil {
+		t.Fatal("Invalid config accepted")
+	}
+	if _, err := f.Profile("zero"); err == nil {
+		t.Error("Profile with port 0 selected")
+	}
+	for _, want := range []string{"colour", "70000", "carrier-pigeon", "sometimes", "not-an-address", "carrier-pigeon-ack", "smoke-signal", "burst -1", "profiles.zero.port 0"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validation error does not mention %q: %v", want, err)
+		}
+	}
+}
+
+func TestFlagAndEnvNames(t *testing.T) {
+	if got := FlagName("save_dir"); got != "save-dir" {
+		t.Errorf("FlagName = %q", got)
+	}
+	if got := EnvName("key_file"); got != "TRANSFER_KEY_FILE" {
+		t.Errorf("EnvName = %q", got)
+	}
+}
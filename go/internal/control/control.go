@@ -0,0 +1,269 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"secure-transfer/internal/approval"
+	"secure-transfer/internal/transfer"
+)
+
+// Commands understood by the control socket
+const (
+	CommandStatus      = "status"
+	CommandPause       = "pause"
+	CommandResume      = "resume"
+	CommandConnections = "connections"
+	CommandReload      = "reload"
+	CommandShutdown    = "shutdown"
+	CommandPending     = "pending"
+	CommandAccept      = "accept"
+	CommandReject      = "reject"
+)
+
+// Commands lists every command in the order `ctl` documents them
+var Commands = []string{
+	CommandStatus, CommandPause, CommandResume, CommandConnections, CommandReload, CommandShutdown,
+	CommandPending, CommandAccept, CommandReject,
+}
+
+// Timeouts for a client to send its request and for the daemon to answer
+const (
+	requestTimeout  = 5 * time.Second
+	responseTimeout = 30 * time.Second
+)
+
+// Request is one command sent to the daemon, as a single JSON line
+type Request struct {
+	Command string `json:"command"`
+
+	// ID is the pending item accept and reject decide on
+	ID uint64 `json:"id,omitempty"`
+}
+
+// Response answers a Request, as a single JSON line
+type Response struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+
+	Status      *Status               `json:"status,omitempty"`
+	Connections []transfer.Connection `json:"connections,omitempty"`
+	Pending     []transfer.Pending    `json:"pending,omitempty"`
+}
+
+// Status describes the running daemon
+type Status struct {
+	PID             int       `json:"pid"`
+	Started         time.Time `json:"started"`
+	Address         string    `json:"address"`
+	Config          string    `json:"config,omitempty"`
+	ClipboardPaused bool      `json:"clipboard_paused"`
+	Connections     int       `json:"connections"`
+	Received        uint64    `json:"received"`
+}
+
+// Server answers commands for a running echo server. Anyone able to open
+// the socket may use it, so it must live in a directory only the owner
+// can enter.
+type Server struct {
+	// State is the running server's state
+	State *transfer.State
+
+	// Address and Config are reported by status
+	Address string
+	Config  string
+
+	// Reload re-reads the configuration
+	Reload func() error
+
+	// Shutdown stops the daemon; it is called after the response is sent
+	Shutdown func()
+
+	// Approvals, when set, holds received items awaiting approval
+	Approvals *approval.Queue
+
+	Logger *slog.Logger
+}
+
+// DefaultPath returns the control socket path in the user's runtime
+// directory, falling back to a per-user directory under the temp dir
+func DefaultPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "secure-transfer", "control.sock")
+	}
+	return filepath.Join(os.TempDir(), "secure-transfer-"+strconv.Itoa(os.Getuid()), "control.sock")
+}
+
+// Listen creates the control socket at path, readable only by the owner.
+// A socket left behind by a daemon that died is replaced; one that still
+// answers is an error.
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := checkDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// checkDir refuses a socket directory someone else could control.
+// MkdirAll leaves an existing directory as it is, and under the shared
+// temp dir another user may have created it first.
+func checkDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("control socket directory %s is not a directory", dir)
+	}
+	if !ownedByCurrentUser(info) {
+		return fmt.Errorf("control socket directory %s is owned by another user", dir)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		return fmt.Errorf("control socket directory %s has mode %04o, want 0700", dir, perm)
+	}
+	return nil
+}
+
+// Serve answers connections on listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers the one request on conn
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	var req Request
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	if err != nil {
+		writeResponse(conn, Response{Error: "malformed request: " + err.Error()})
+		return
+	}
+
+	resp := s.execute(req)
+	writeResponse(conn, resp)
+	if resp.OK && req.Command == CommandShutdown {
+		s.Shutdown()
+	}
+}
+
+// execute runs a command
+func (s *Server) execute(req Request) Response {
+	s.Logger.Debug("Control command", "command", req.Command)
+	switch req.Command {
+	case CommandStatus:
+		return Response{OK: true, Status: &Status{
+			PID:             os.Getpid(),
+			Started:         s.State.Started(),
+			Address:         s.Address,
+			Config:          s.Config,
+			ClipboardPaused: s.State.ClipboardPaused(),
+			Connections:     len(s.State.Connections()),
+			Received:        s.State.Received(),
+		}}
+	case CommandPause:
+		s.State.PauseClipboard(true)
+		s.Logger.Info("Clipboard writes paused", "source", "control")
+		return Response{OK: true}
+	case CommandResume:
+		s.State.PauseClipboard(false)
+		s.Logger.Info("Clipboard writes resumed", "source", "control")
+		return Response{OK: true}
+	case CommandConnections:
+		return Response{OK: true, Connections: s.State.Connections()}
+	case CommandReload:
+		if err := s.Reload(); err != nil {
+			s.Logger.Error("Reload failed", "error", err)
+			return Response{Error: err.Error()}
+		}
+		return Response{OK: true}
+	case CommandShutdown:
+		s.Logger.Info("Shutdown requested", "source", "control")
+		return Response{OK: true}
+	case CommandPending, CommandAccept, CommandReject:
+		if s.Approvals == nil {
+			return Response{Error: "approval through the control socket is not enabled (see --approve)"}
+		}
+		if req.Command == CommandPending {
+			return Response{OK: true, Pending: s.Approvals.Pending()}
+		}
+		if err := s.Approvals.Decide(req.ID, req.Command == CommandAccept); err != nil {
+			return Response{Error: err.Error()}
+		}
+		return Response{OK: true}
+	}
+	return Response{Error: fmt.Sprintf("unknown command %q", req.Command)}
+}
+
+func writeResponse(conn net.Conn, resp Response) {
+	data, _ := json.Marshal(resp)
+	conn.Write(append(data, '\n'))
+}
+
+// Call sends req to the daemon listening on path and returns its
+// response. A response reporting failure is returned as an error.
+func Call(path string, req Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", path, requestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not reachable on %s: %w", path, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(responseTimeout))
+
+	data, _ := json.Marshal(req)
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("error reading daemon response: %w", err)
+	}
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("malformed daemon response: %w", err)
+	}
+	if !resp.OK {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,180 @@
+package control
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"secure-transfer/internal/approval"
+	"secure-transfer/internal/transfer"
+)
+
+// testLogger returns a logger discarding everything tests log
+func testLogger(t *testing.T) *slog.Logger {
+	t.Helper()
+	return slog.New(slog.DiscardHandler)
+}
+
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	// Unix socket paths are short, so avoid the long test temp dir
+	dir, err := os.MkdirTemp("", "ctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "run", "control.sock")
+
+	listener, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go s.Serve(listener)
+	return path
+}
+
+func TestCommands(t *testing.T) {
+	reloads, shutdown := 0, make(chan struct{})
+	s := &Server{
+		State:   transfer.NewState(),
+		Address: "0.0.0.0:8080",
+		Reload: func() error {
+			reloads++
+			if reloads > 1 {
+				return errors.New("config file is invalid")
+			}
+			return nil
+		},
+		Shutdown: func() { close(shutdown) },
+		Logger:   testLogger(t),
+	}
+	path := startServer(t, s)
+
+	resp, err := Call(path, Request{Command: CommandStatus})
+	if err != nil || resp.Status == nil {
+		t.Fatalf("status = %+v, %v", resp, err)
+	}
+	if resp.Status.PID != os.Getpid() || resp.Status.Address != "0.0.0.0:8080" || resp.Status.ClipboardPaused {
+		t.Errorf("Unexpected status %+v", resp.Status)
+	}
+
+	if _, err := Call(path, Request{Command: CommandPause}); err != nil || !s.State.ClipboardPaused() {
+		t.Errorf("pause = %v, paused %v", err, s.State.ClipboardPaused())
+	}
+	if _, err := Call(path, Request{Command: CommandResume}); err != nil || s.State.ClipboardPaused() {
+		t.Errorf("resume = %v, paused %v", err, s.State.ClipboardPaused())
+	}
+
+	if _, err := Call(path, Request{Command: CommandReload}); err != nil {
+		t.Errorf("First reload failed: %v", err)
+	}
+	if _, err := Call(path, Request{Command: CommandReload}); err == nil || err.Error() != "config file is invalid" {
+		t.Errorf("Failed reload returned %v", err)
+	}
+	if _, err := Call(path, Request{Command: "restart"}); err == nil {
+		t.Error("Unknown command accepted")
+	}
+
+	if _, err := Call(path, Request{Command: CommandShutdown}); err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+	select {
+	case <-shutdown:
+	case <-time.After(time.Second):
+		t.Error("Shutdown was not called")
+	}
+}
+
+func TestApprovals(t *testing.T) {
+	logger := testLogger(t)
+	if _, err := Call(startServer(t, &Server{Logger: logger}), Request{Command: CommandPending}); err == nil {
+		t.Error("pending succeeded without an approval queue")
+	}
+
+	queue := approval.NewQueue(time.Minute, logger)
+	path := startServer(t, &Server{Approvals: queue, Logger: logger})
+	result := make(chan bool, 1)
+	go func() { result <- queue.Approve(transfer.Pending{Type: "message", Preview: "hi"}) }()
+
+	var resp *Response
+	for range 100 {
+		var err error
+		if resp, err = Call(path, Request{Command: CommandPending}); err == nil && len(resp.Pending) == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(resp.Pending) != 1 {
+		t.Fatalf("pending = %+v", resp)
+	}
+	if _, err := Call(path, Request{Command: CommandReject, ID: resp.Pending[0].ID}); err != nil {
+		t.Fatalf("reject failed: %v", err)
+	}
+	if <-result {
+		t.Error("Rejected item was accepted")
+	}
+	if _, err := Call(path, Request{Command: CommandAccept, ID: resp.Pending[0].ID}); err == nil {
+		t.Error("Decided the same item twice")
+	}
+}
+
+func TestListen(t *testing.T) {
+	path := startServer(t, &Server{State: transfer.NewState(), Logger: testLogger(t)})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Socket missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Socket permissions = %v, want 0600", info.Mode().Perm())
+	}
+	if _, err := Listen(path); err == nil {
+		t.Error("Second daemon took over a live socket")
+	}
+
+	// A stale file left by a daemon that died is replaced
+	stale := filepath.Join(filepath.Dir(path), "stale.sock")
+	os.WriteFile(stale, nil, 0600)
+	listener, err := Listen(stale)
+	if err != nil {
+		t.Fatalf("Stale socket not replaced: %v", err)
+	}
+	listener.Close()
+}
+
+func TestListenRefusesUnsafeDirectory(t *testing.T) {
+	base, err := os.MkdirTemp("", "ctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(base) })
+
+	// Created by someone else with a looser mode
+	open := filepath.Join(base, "open")
+	if err := os.Mkdir(open, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(open, 0755)
+	if listener, err := Listen(filepath.Join(open, "control.sock")); err == nil {
+		listener.Close()
+		t.Error("Listen accepted a directory other users can enter")
+	}
+
+	// A symlink to a directory someone else could swap
+	target := filepath.Join(base, "target")
+	if err := os.Mkdir(target, 0700); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlinks unavailable: %v", err)
+	}
+	if listener, err := Listen(filepath.Join(link, "control.sock")); err == nil {
+		listener.Close()
+		t.Error("Listen accepted a symlinked directory")
+	}
+}
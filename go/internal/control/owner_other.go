@@ -0,0 +1,10 @@
+//go:build !unix
+
+package control
+
+import "os"
+
+// ownedByCurrentUser is always true where files have no Unix owner
+func ownedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package control
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByCurrentUser reports whether the process's user owns info's file
+func ownedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
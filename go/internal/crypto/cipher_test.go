@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCipherSuites(t *testing.T) {
+	key, _ := GenerateKey()
+	data := []byte("sealed by every suite")
+
+	for _, name := range SupportedCiphers {
+		t.Run(name, func(t *testing.T) {
+			suite, err := CipherByName(name)
+			if err != nil {
+				t.Fatalf("Failed to look up cipher: %v", err)
+			}
+
+			sealed, err := suite.Seal(data, key, []byte("aad"))
+			if err != nil {
+				t.Fatalf("Failed to seal: %v", err)
+			}
+			opened, err := suite.Open(sealed, key, []byte("aad"))
+			if err != nil {
+				t.Fatalf("Failed to open: %v", err)
+			}
+			if !bytes.Equal(opened, data) {
+				t.Error("Opened data doesn't match original")
+			}
+
+			if _, err := suite.Open(sealed, key, []byte("other")); err == nil {
+				t.Error("Expected open with different AAD to fail")
+			}
+			if _, err := suite.Seal(data, key[:16], nil); err == nil {
+				t.Error("Expected short key to be rejected")
+			}
+		})
+	}
+
+	// Suites must not accept each other's output
+	aesSealed, _ := AES256GCM{}.Seal(data, key, nil)
+	if _, err := (XChaCha20Poly1305{}).Open(aesSealed, key, nil); err == nil {
+		t.Error("XChaCha20-Poly1305 opened AES-256-GCM output")
+	}
+}
+
+func TestSelectCipher(t *testing.T) {
+	testCases := []struct {
+		name    string
+		offers  []string
+		allowed []string
+		want    string
+	}{
+		{"Client preference", []string{CipherXChaCha20Poly1305, CipherAES256GCM}, SupportedCiphers, CipherXChaCha20Poly1305},
+		{"Receiver restriction", []string{CipherXChaCha20Poly1305, CipherAES256GCM}, []string{CipherAES256GCM}, CipherAES256GCM},
+		{"Legacy client", nil, SupportedCiphers, CipherAES256GCM},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			suite, err := SelectCipher(tc.offers, tc.allowed)
+			if err != nil {
+				t.Fatalf("Failed to select: %v", err)
+			}
+			if suite.Name() != tc.want {
+				t.Errorf("Selected %s, want %s", suite.Name(), tc.want)
+			}
+		})
+	}
+
+	if _, err := SelectCipher([]string{CipherXChaCha20Poly1305}, []string{CipherAES256GCM}); err == nil {
+		t.Error("Expected no common cipher")
+	}
+}
+
+func BenchmarkCiphers(b *testing.B) {
+	key, _ := GenerateKey()
+	aad := make([]byte, 26)
+
+	for _, name := range SupportedCiphers {
+		suite, _ := CipherByName(name)
+		for _, size := range []int{1024, 64 * 1024, 1024 * 1024} {
+			data := make([]byte, size)
+			b.Run(fmt.Sprintf("%s/seal/%dKiB", name, size/1024), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					if _, err := suite.Seal(data, key, aad); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			sealed, _ := suite.Seal(data, key, aad)
+			b.Run(fmt.Sprintf("%s/open/%dKiB", name, size/1024), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					if _, err := suite.Open(sealed, key, aad); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
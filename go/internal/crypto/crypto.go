@@ -4,30 +4,37 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"log/slog"
-	"os"
 )
 
-// GetAESKey gets or generates AES key (must be 32 bytes)
-func GetAESKey(logger *slog.Logger) ([]byte, error) {
-	keyBase64 := os.Getenv("TRANSFER_KEY")
-	if keyBase64 == "" {
-		key := make([]byte, 32)
-		_, err := rand.Read(key)
-		if err != nil {
-			return nil, err
-		}
-		encodedKey := base64.StdEncoding.EncodeToString(key)
-		logger.Info("Generated new encryption key", "key", encodedKey)
-		return key, nil
-	}
-	return base64.StdEncoding.DecodeString(keyBase64)
+// GetAESKey loads and validates the key set from the first configured source
+func GetAESKey(opts KeyOptions, logger *slog.Logger) (*KeySet, error) {
+	keys, source, err := loadKeySource(opts)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("Loaded encryption key", "source", source, "key_id", KeyID(keys.Current), "retired", len(keys.Previous))
+	return keys, nil
 }
 
 // Encrypt data using AES-GCM
 func Encrypt(data []byte, key []byte) ([]byte, error) {
+	return EncryptWithAAD(data, key, nil)
+}
+
+// Decrypt data using AES-GCM
+func Decrypt(data []byte, key []byte) ([]byte, error) {
+	return DecryptWithAAD(data, key, nil)
+}
+
+// EncryptWithAAD encrypts data using AES-GCM, authenticating additionalData
+// without encrypting it. Decryption fails unless the same additionalData is
+// supplied.
+func EncryptWithAAD(data []byte, key []byte, additionalData []byte) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -40,15 +47,18 @@ func Encrypt(data []byte, key []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	ciphertext := aesGCM.Seal(nil, nonce, data, nil)
+	ciphertext := aesGCM.Seal(nil, nonce, data, additionalData)
 	return append(nonce, ciphertext...), nil
 }
 
-// Decrypt data using AES-GCM
-func Decrypt(data []byte, key []byte) ([]byte, error) {
+// DecryptWithAAD decrypts data sealed by EncryptWithAAD with the same additionalData
+func DecryptWithAAD(data []byte, key []byte, additionalData []byte) ([]byte, error) {
 	if len(data) < 12 {
 		return nil, errors.New("invalid data")
 	}
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
 	nonce := data[:12]
 	ciphertext := data[12:]
 	block, err := aes.NewCipher(key)
@@ -59,5 +69,5 @@ func Decrypt(data []byte, key []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return aesGCM.Open(nil, nonce, ciphertext, nil)
+	return aesGCM.Open(nil, nonce, ciphertext, additionalData)
 }
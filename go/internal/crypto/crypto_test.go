@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -84,15 +85,28 @@ func TestEncryptDecrypt(t *testing.T) {
 
 func TestGetAESKey(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	keyFile := filepath.Join(t.TempDir(), "transfer.key")
 
-	// Test with no environment variable
+	// Test with no environment variable and no key file
 	os.Unsetenv("TRANSFER_KEY")
-	key1, err := GetAESKey(logger)
+	if _, err := GetAESKey(KeyOptions{File: keyFile}, logger); err == nil {
+		t.Fatal("Expected an error when no key is configured")
+	}
+
+	// Test with a key file
+	fileKey, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if err := SaveKeyFile(keyFile, &KeySet{Current: fileKey}); err != nil {
+		t.Fatalf("Failed to save key file: %v", err)
+	}
+	key1, err := GetAESKey(KeyOptions{File: keyFile}, logger)
 	if err != nil {
-		t.Fatalf("Failed to get key: %v", err)
+		t.Fatalf("Failed to get key from file: %v", err)
 	}
-	if len(key1) != 32 {
-		t.Errorf("Key length should be 32, got %d", len(key1))
+	if !bytes.Equal(key1.Current, fileKey) {
+		t.Errorf("Key from file doesn't match expected")
 	}
 
 	// Test with environment variable
@@ -102,14 +116,39 @@ func TestGetAESKey(t *testing.T) {
 	}
 	os.Setenv("TRANSFER_KEY", base64.StdEncoding.EncodeToString(testKey))
 
-	key2, err := GetAESKey(logger)
+	key2, err := GetAESKey(KeyOptions{File: keyFile}, logger)
 	if err != nil {
 		t.Fatalf("Failed to get key from env: %v", err)
 	}
-	if !bytes.Equal(key2, testKey) {
+	if !bytes.Equal(key2.Current, testKey) {
 		t.Errorf("Key from env doesn't match expected")
 	}
 
 	// Cleanup
 	os.Unsetenv("TRANSFER_KEY")
 }
+
+func TestEncryptDecryptWithAAD(t *testing.T) {
+	key := make([]byte, 32)
+	data := []byte("bound to its context")
+
+	encrypted, err := EncryptWithAAD(data, key, []byte("context A"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	decrypted, err := DecryptWithAAD(encrypted, key, []byte("context A"))
+	if err != nil {
+		t.Fatalf("Failed to decrypt with matching AAD: %v", err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("Decrypted data doesn't match original")
+	}
+
+	if _, err := DecryptWithAAD(encrypted, key, []byte("context B")); err == nil {
+		t.Error("Expected decryption with different AAD to fail")
+	}
+	if _, err := Decrypt(encrypted, key); err == nil {
+		t.Error("Expected decryption without AAD to fail")
+	}
+}
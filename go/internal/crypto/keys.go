@@ -0,0 +1,172 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KeySize is the AES-256 key length in bytes
+const KeySize = 32
+
+// Export formats understood by ExportKey and ImportKey
+const (
+	FormatBase64 = "base64"
+	FormatQR     = "qr"
+)
+
+// KeySet is the content of a key file: the key used for sending plus
+// retired keys still accepted when receiving until their grace period ends
+type KeySet struct {
+	Current  []byte       `json:"current"`
+	Previous []RetiredKey `json:"previous,omitempty"`
+}
+
+// RetiredKey is a rotated-out key accepted until Expires
+type RetiredKey struct {
+	Key     []byte    `json:"key"`
+	Expires time.Time `json:"expires"`
+}
+
+// GenerateKey returns a new random AES-256 key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KeyID returns a short identifier for a key that is safe to log
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// LoadKeyFile reads a key set written by SaveKeyFile
+func LoadKeyFile(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys KeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("malformed key file %s: %w", path, err)
+	}
+	source := "key file " + path
+	if len(keys.Current) != KeySize {
+		return nil, &KeyLengthError{Source: source, Length: len(keys.Current)}
+	}
+	for _, retired := range keys.Previous {
+		if len(retired.Key) != KeySize {
+			return nil, &KeyLengthError{Source: source, Length: len(retired.Key)}
+		}
+	}
+	return &keys, nil
+}
+
+// SaveKeyFile writes a key set readable only by the owner
+func SaveKeyFile(path string, keys *KeySet) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated key file. The
+	// temporary file is new, so it is created 0600 whatever was left
+	// behind by an earlier attempt.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".transfer-key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Replace makes key current, keeping the old current key accepted for grace
+func (ks *KeySet) Replace(key []byte, grace time.Duration) {
+	now := time.Now()
+	if len(ks.Current) > 0 && grace > 0 {
+		ks.Previous = append(ks.Previous, RetiredKey{Key: ks.Current, Expires: now.Add(grace)})
+	}
+	ks.Current = key
+	ks.Prune(now)
+}
+
+// Rotate replaces the current key with a freshly generated one
+func (ks *KeySet) Rotate(grace time.Duration) error {
+	key, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	ks.Replace(key, grace)
+	return nil
+}
+
+// Prune drops retired keys whose grace period has ended
+func (ks *KeySet) Prune(now time.Time) {
+	kept := ks.Previous[:0]
+	for _, retired := range ks.Previous {
+		if now.Before(retired.Expires) {
+			kept = append(kept, retired)
+		}
+	}
+	ks.Previous = kept
+}
+
+// Accepted returns the retired keys still accepted at now
+func (ks *KeySet) Accepted(now time.Time) [][]byte {
+	var keys [][]byte
+	for _, retired := range ks.Previous {
+		if now.Before(retired.Expires) {
+			keys = append(keys, retired.Key)
+		}
+	}
+	return keys
+}
+
+// ExportKey renders a key as base64, or as upper-case base32 groups that fit
+// the QR alphanumeric mode and are easy to read out
+func ExportKey(key []byte, format string) (string, error) {
+	switch format {
+	case FormatBase64:
+		return base64.StdEncoding.EncodeToString(key), nil
+	case FormatQR:
+		encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+		var groups []string
+		for len(encoded) > 4 {
+			groups = append(groups, encoded[:4])
+			encoded = encoded[4:]
+		}
+		return strings.Join(append(groups, encoded), " "), nil
+	default:
+		return "", fmt.Errorf("unknown key format %q (want base64 or qr)", format)
+	}
+}
+
+// ImportKey parses a key produced by ExportKey or given in any encoding
+// TRANSFER_KEY accepts
+func ImportKey(text string) ([]byte, error) {
+	return parseKey("input", []byte(text), false)
+}
@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "transfer.key")
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	// Left readable by an older version that wrote through path.tmp
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := os.WriteFile(path+".tmp", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveKeyFile(path, &KeySet{Current: key}); err != nil {
+		t.Fatalf("Failed to save key file: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Key file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Key file permissions = %v, want 0600", info.Mode().Perm())
+	}
+
+	keys, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load key file: %v", err)
+	}
+	if !bytes.Equal(keys.Current, key) {
+		t.Error("Loaded key doesn't match saved key")
+	}
+	if data, _ := os.ReadFile(path + ".tmp"); len(data) != 0 {
+		t.Error("Key written through a pre-existing temporary file")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 2 {
+		t.Errorf("Temporary files left behind: %v", entries)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	original, _ := GenerateKey()
+	keys := &KeySet{Current: original}
+
+	if err := keys.Rotate(time.Hour); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if bytes.Equal(keys.Current, original) {
+		t.Fatal("Rotation kept the same key")
+	}
+
+	accepted := keys.Accepted(time.Now())
+	if len(accepted) != 1 || !bytes.Equal(accepted[0], original) {
+		t.Errorf("Retired key should be accepted during the grace period")
+	}
+	if len(keys.Accepted(time.Now().Add(2*time.Hour))) != 0 {
+		t.Errorf("Retired key should not be accepted after the grace period")
+	}
+
+	keys.Prune(time.Now().Add(2 * time.Hour))
+	if len(keys.Previous) != 0 {
+		t.Errorf("Prune kept %d expired keys", len(keys.Previous))
+	}
+
+	// Rotating without grace discards the old key immediately
+	if err := keys.Rotate(0); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if len(keys.Previous) != 0 {
+		t.Errorf("Rotation without grace kept %d keys", len(keys.Previous))
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	key, _ := GenerateKey()
+
+	for _, format := range []string{FormatBase64, FormatQR} {
+		t.Run(format, func(t *testing.T) {
+			text, err := ExportKey(key, format)
+			if err != nil {
+				t.Fatalf("Failed to export: %v", err)
+			}
+			imported, err := ImportKey(text)
+			if err != nil {
+				t.Fatalf("Failed to import %q: %v", text, err)
+			}
+			if !bytes.Equal(imported, key) {
+				t.Error("Imported key doesn't match exported key")
+			}
+		})
+	}
+
+	if _, err := ImportKey("dG9vIHNob3J0"); err == nil {
+		t.Error("Expected short key to be rejected")
+	}
+}
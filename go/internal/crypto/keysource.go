@@ -0,0 +1,207 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrNoKey is returned when no key source is configured
+var ErrNoKey = errors.New("no encryption key configured")
+
+// KeyLengthError reports a key that decoded to the wrong number of bytes
+type KeyLengthError struct {
+	Source string
+	Length int
+}
+
+func (e *KeyLengthError) Error() string {
+	return fmt.Sprintf("key from %s is %d bytes, want %d (AES-256)", e.Source, e.Length, KeySize)
+}
+
+// KeyEncodingError reports key text that is not in any accepted encoding
+type KeyEncodingError struct {
+	Source string
+}
+
+func (e *KeyEncodingError) Error() string {
+	return fmt.Sprintf("key from %s is not valid hex, base64, URL-safe base64, base32 or raw bytes", e.Source)
+}
+
+// KeySourceError reports a key source that could not be read
+type KeySourceError struct {
+	Source string
+	Err    error
+}
+
+func (e *KeySourceError) Error() string {
+	return fmt.Sprintf("cannot read key from %s: %v", e.Source, e.Err)
+}
+
+func (e *KeySourceError) Unwrap() error {
+	return e.Err
+}
+
+// KeyOptions selects where GetAESKey looks for the key. Sources are tried
+// in the order FD, Keyring, TRANSFER_KEY, File and the first one set wins.
+type KeyOptions struct {
+	// File is a key file written by SaveKeyFile
+	File string
+
+	// FD is an inherited file descriptor holding the key; ignored when zero
+	FD int
+
+	// KeyringAccount names the key in the OS keyring; ignored when empty
+	KeyringAccount string
+
+	// Keyring looks up KeyringAccount; the system keyring when nil
+	Keyring Keyring
+}
+
+// Keyring fetches secrets from an OS credential store
+type Keyring interface {
+	Get(service, account string) ([]byte, error)
+}
+
+// keyringService is the service name keys are stored under
+const keyringService = "secure-transfer"
+
+// CommandKeyring reads secrets with the platform's keyring tool
+type CommandKeyring struct{}
+
+// Get looks up a secret with secret-tool on Linux or security on macOS
+func (CommandKeyring) Get(service, account string) ([]byte, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-w", "-s", service, "-a", account)
+	default:
+		return nil, fmt.Errorf("no keyring support on %s", runtime.GOOS)
+	}
+	return cmd.Output()
+}
+
+// loadKeySource reads and validates the key from the first configured source
+func loadKeySource(opts KeyOptions) (*KeySet, string, error) {
+	if opts.FD > 0 {
+		source := fmt.Sprintf("file descriptor %d", opts.FD)
+		f := os.NewFile(uintptr(opts.FD), source)
+		if f == nil {
+			return nil, source, &KeySourceError{Source: source, Err: os.ErrInvalid}
+		}
+		defer f.Close()
+		data, err := io.ReadAll(io.LimitReader(f, 4096))
+		if err != nil {
+			return nil, source, &KeySourceError{Source: source, Err: err}
+		}
+		key, err := parseKey(source, data, true)
+		if err != nil {
+			return nil, source, err
+		}
+		return &KeySet{Current: key}, source, nil
+	}
+
+	if opts.KeyringAccount != "" {
+		source := "keyring account " + opts.KeyringAccount
+		keyring := opts.Keyring
+		if keyring == nil {
+			keyring = CommandKeyring{}
+		}
+		data, err := keyring.Get(keyringService, opts.KeyringAccount)
+		if err != nil {
+			return nil, source, &KeySourceError{Source: source, Err: err}
+		}
+		key, err := parseKey(source, data, true)
+		if err != nil {
+			return nil, source, err
+		}
+		return &KeySet{Current: key}, source, nil
+	}
+
+	if text := os.Getenv("TRANSFER_KEY"); text != "" {
+		source := "TRANSFER_KEY"
+		key, err := parseKey(source, []byte(text), false)
+		if err != nil {
+			return nil, source, err
+		}
+		return &KeySet{Current: key}, source, nil
+	}
+
+	if opts.File == "" {
+		return nil, "", ErrNoKey
+	}
+	source := "key file " + opts.File
+	keys, err := LoadKeyFile(opts.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, source, ErrNoKey
+	}
+	if err != nil {
+		return nil, source, err
+	}
+	return keys, source, nil
+}
+
+// parseKey decodes a key given as hex, standard or URL-safe base64 (padded
+// or not) or base32 groups as printed by ExportKey. Binary sources may also
+// hold the 32 raw bytes when allowRaw is set.
+func parseKey(source string, data []byte, allowRaw bool) ([]byte, error) {
+	if allowRaw {
+		// Untrimmed first, as a raw key may itself end in a newline byte.
+		// No text encoding of a key is this short, so nothing is shadowed.
+		for _, raw := range [][]byte{data, bytes.TrimSuffix(data, []byte("\n"))} {
+			if len(raw) == KeySize {
+				return raw, nil
+			}
+		}
+	}
+	text := strings.TrimSpace(string(data))
+
+	decoders := []func(string) ([]byte, error){
+		hex.DecodeString,
+		base64.StdEncoding.DecodeString,
+		base64.RawStdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+		base64.RawURLEncoding.DecodeString,
+		func(s string) ([]byte, error) {
+			compact := strings.ToUpper(strings.Join(strings.Fields(s), ""))
+			return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(compact)
+		},
+	}
+
+	decodedLength := -1
+	for _, decode := range decoders {
+		key, err := decode(text)
+		if err != nil {
+			continue
+		}
+		if len(key) == KeySize {
+			return key, nil
+		}
+		if decodedLength < 0 {
+			decodedLength = len(key)
+		}
+	}
+
+	if decodedLength >= 0 {
+		return nil, &KeyLengthError{Source: source, Length: decodedLength}
+	}
+	return nil, &KeyEncodingError{Source: source}
+}
+
+// checkKey rejects keys that would not select AES-256
+func checkKey(key []byte) error {
+	if len(key) != KeySize {
+		return &KeyLengthError{Source: "caller", Length: len(key)}
+	}
+	return nil
+}
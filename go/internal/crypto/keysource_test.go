@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+// fakeKeyring serves secrets from memory
+type fakeKeyring map[string][]byte
+
+// testLogger returns a logger discarding everything tests log
+func testLogger(t *testing.T) *slog.Logger {
+	t.Helper()
+	return slog.New(slog.DiscardHandler)
+}
+
+func (k fakeKeyring) Get(service, account string) ([]byte, error) {
+	secret, ok := k[service+"/"+account]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return secret, nil
+}
+
+func TestKeyEncodings(t *testing.T) {
+	logger := testLogger(t)
+	key := make([]byte, KeySize)
+	for i := range key {
+		key[i] = byte(250 - i) // Exercises the base64 characters that differ in URL-safe form
+	}
+	qr, _ := ExportKey(key, FormatQR)
+
+	testCases := []struct {
+		name string
+		text string
+	}{
+		{"Base64", base64.StdEncoding.EncodeToString(key)},
+		{"Base64 unpadded", base64.RawStdEncoding.EncodeToString(key)},
+		{"URL-safe base64", base64.URLEncoding.EncodeToString(key)},
+		{"URL-safe base64 unpadded", base64.RawURLEncoding.EncodeToString(key)},
+		{"Hex", hex.EncodeToString(key)},
+		{"QR", qr},
+		{"Trailing newline", base64.StdEncoding.EncodeToString(key) + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TRANSFER_KEY", tc.text)
+			keys, err := GetAESKey(KeyOptions{}, logger)
+			if err != nil {
+				t.Fatalf("Failed to load key: %v", err)
+			}
+			if !bytes.Equal(keys.Current, key) {
+				t.Errorf("Loaded key doesn't match")
+			}
+		})
+	}
+}
+
+func TestKeyErrors(t *testing.T) {
+	logger := testLogger(t)
+
+	t.Run("Short key", func(t *testing.T) {
+		t.Setenv("TRANSFER_KEY", base64.StdEncoding.EncodeToString(make([]byte, 16)))
+		_, err := GetAESKey(KeyOptions{}, logger)
+		var lengthErr *KeyLengthError
+		if !errors.As(err, &lengthErr) {
+			t.Fatalf("Expected KeyLengthError, got %v", err)
+		}
+		if lengthErr.Length != 16 || lengthErr.Source != "TRANSFER_KEY" {
+			t.Errorf("Got length %d from %q", lengthErr.Length, lengthErr.Source)
+		}
+	})
+
+	t.Run("Raw text in environment", func(t *testing.T) {
+		t.Setenv("TRANSFER_KEY", "this passphrase is 32 chars long")
+		_, err := GetAESKey(KeyOptions{}, logger)
+		if err == nil {
+			t.Fatal("Expected raw text in TRANSFER_KEY to be rejected")
+		}
+	})
+
+	t.Run("Bad encoding", func(t *testing.T) {
+		t.Setenv("TRANSFER_KEY", "not a key!")
+		_, err := GetAESKey(KeyOptions{}, logger)
+		var encodingErr *KeyEncodingError
+		if !errors.As(err, &encodingErr) {
+			t.Fatalf("Expected KeyEncodingError, got %v", err)
+		}
+	})
+
+	t.Run("No key", func(t *testing.T) {
+		t.Setenv("TRANSFER_KEY", "")
+		_, err := GetAESKey(KeyOptions{File: t.TempDir() + "/missing.key"}, logger)
+		if !errors.Is(err, ErrNoKey) {
+			t.Fatalf("Expected ErrNoKey, got %v", err)
+		}
+	})
+
+	t.Run("Missing keyring entry", func(t *testing.T) {
+		_, err := GetAESKey(KeyOptions{KeyringAccount: "work", Keyring: fakeKeyring{}}, logger)
+		var sourceErr *KeySourceError
+		if !errors.As(err, &sourceErr) {
+			t.Fatalf("Expected KeySourceError, got %v", err)
+		}
+	})
+
+	t.Run("Encrypt with short key", func(t *testing.T) {
+		_, err := Encrypt([]byte("data"), make([]byte, 24))
+		var lengthErr *KeyLengthError
+		if !errors.As(err, &lengthErr) {
+			t.Fatalf("Expected KeyLengthError, got %v", err)
+		}
+	})
+}
+
+func TestKeySources(t *testing.T) {
+	logger := testLogger(t)
+	key, _ := GenerateKey()
+	endsInNewline := bytes.Clone(key)
+	endsInNewline[KeySize-1] = '\n'
+	t.Setenv("TRANSFER_KEY", "")
+
+	testCases := []struct {
+		name   string
+		secret []byte
+		want   []byte
+	}{
+		{"Keyring raw bytes", key, key},
+		{"Keyring raw bytes with trailing newline", append(bytes.Clone(key), '\n'), key},
+		{"Keyring raw bytes ending in a newline byte", endsInNewline, endsInNewline},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keyring := fakeKeyring{"secure-transfer/work": tc.secret}
+			keys, err := GetAESKey(KeyOptions{KeyringAccount: "work", Keyring: keyring}, logger)
+			if err != nil {
+				t.Fatalf("Failed to load key from keyring: %v", err)
+			}
+			if !bytes.Equal(keys.Current, tc.want) {
+				t.Error("Keyring key doesn't match")
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestKeyFromFileDescriptor(t *testing.T) {
+	logger := testLogger(t)
+	key, _ := GenerateKey()
+	t.Setenv("TRANSFER_KEY", "")
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	w.Write([]byte(hex.EncodeToString(key) + "\n"))
+	w.Close()
+
+	// GetAESKey closes the descriptor it reads, so hand it a duplicate
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to duplicate fd: %v", err)
+	}
+
+	keys, err := GetAESKey(KeyOptions{FD: fd}, logger)
+	if err != nil {
+		t.Fatalf("Failed to load key from fd: %v", err)
+	}
+	if !bytes.Equal(keys.Current, key) {
+		t.Error("File descriptor key doesn't match")
+	}
+}
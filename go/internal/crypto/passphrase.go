@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// SaltSize is the length of the Argon2id salt in bytes
+const SaltSize = 16
+
+// KDFParams are the Argon2id cost parameters
+type KDFParams struct {
+	// Time is the number of passes over memory
+	Time uint32 `json:"time"`
+
+	// Memory is the memory cost in KiB
+	Memory uint32 `json:"memory"`
+
+	// Threads is the degree of parallelism
+	Threads uint8 `json:"threads"`
+}
+
+// DefaultKDFParams follows the RFC 9106 second recommended option
+var DefaultKDFParams = KDFParams{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// Bounds on the parameters Validate accepts. A receiver also refuses
+// parameters cheaper than its own (see AtLeast), so these bounds only cap
+// what a sender can make it spend.
+const (
+	minKDFMemory  = 8 * 1024
+	maxKDFMemory  = 256 * 1024
+	maxKDFTime    = 16
+	maxKDFThreads = 16
+)
+
+// Validate checks the parameters are within the accepted bounds
+func (p KDFParams) Validate() error {
+	switch {
+	case p.Time < 1 || p.Time > maxKDFTime:
+		return fmt.Errorf("argon2id time cost %d outside 1-%d", p.Time, maxKDFTime)
+	case p.Memory < minKDFMemory || p.Memory > maxKDFMemory:
+		return fmt.Errorf("argon2id memory cost %d KiB outside %d-%d", p.Memory, minKDFMemory, maxKDFMemory)
+	case p.Threads < 1 || p.Threads > maxKDFThreads:
+		return fmt.Errorf("argon2id parallelism %d outside 1-%d", p.Threads, maxKDFThreads)
+	}
+	return nil
+}
+
+// AtLeast checks p costs no less time and memory than floor, so a peer
+// cannot talk the other side into a weaker derivation
+func (p KDFParams) AtLeast(floor KDFParams) error {
+	if p.Time < floor.Time || p.Memory < floor.Memory {
+		return fmt.Errorf("argon2id cost t=%d m=%d KiB is weaker than the required t=%d m=%d KiB", p.Time, p.Memory, floor.Time, floor.Memory)
+	}
+	return nil
+}
+
+// NewSalt returns a random salt for DeriveKey
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// DeriveKey derives an AES-256 key from a passphrase with Argon2id
+func DeriveKey(passphrase string, salt []byte, params KDFParams) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	if len(salt) != SaltSize {
+		return nil, fmt.Errorf("salt is %d bytes, want %d", len(salt), SaltSize)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, KeySize), nil
+}
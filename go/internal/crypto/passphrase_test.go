@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	params := KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatalf("Failed to create salt: %v", err)
+	}
+
+	key1, err := DeriveKey("correct horse battery staple", salt, params)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+	if len(key1) != KeySize {
+		t.Fatalf("Derived key is %d bytes, want %d", len(key1), KeySize)
+	}
+
+	key2, _ := DeriveKey("correct horse battery staple", salt, params)
+	if !bytes.Equal(key1, key2) {
+		t.Error("Same passphrase and salt should derive the same key")
+	}
+
+	otherSalt, _ := NewSalt()
+	key3, _ := DeriveKey("correct horse battery staple", otherSalt, params)
+	if bytes.Equal(key1, key3) {
+		t.Error("Different salts should derive different keys")
+	}
+
+	key4, _ := DeriveKey("correct horse battery staple", salt, KDFParams{Time: 2, Memory: 8 * 1024, Threads: 1})
+	if bytes.Equal(key1, key4) {
+		t.Error("Different costs should derive different keys")
+	}
+}
+
+func TestDeriveKeyRejectsBadParams(t *testing.T) {
+	salt, _ := NewSalt()
+
+	testCases := []struct {
+		name       string
+		passphrase string
+		salt       []byte
+		params     KDFParams
+	}{
+		{"Empty passphrase", "", salt, DefaultKDFParams},
+		{"Short salt", "secret", salt[:8], DefaultKDFParams},
+		{"Zero time", "secret", salt, KDFParams{Time: 0, Memory: 64 * 1024, Threads: 1}},
+		{"Tiny memory", "secret", salt, KDFParams{Time: 1, Memory: 1024, Threads: 1}},
+		{"Huge memory", "secret", salt, KDFParams{Time: 1, Memory: 64 * 1024 * 1024, Threads: 1}},
+		{"Memory above cap", "secret", salt, KDFParams{Time: 1, Memory: 512 * 1024, Threads: 1}},
+		{"No threads", "secret", salt, KDFParams{Time: 1, Memory: 64 * 1024, Threads: 0}},
+		{"Too many threads", "secret", salt, KDFParams{Time: 1, Memory: 64 * 1024, Threads: 255}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DeriveKey(tc.passphrase, tc.salt, tc.params); err == nil {
+				t.Error("Expected derivation to be refused")
+			}
+		})
+	}
+}
+
+func TestKDFParamsAtLeast(t *testing.T) {
+	if err := DefaultKDFParams.AtLeast(DefaultKDFParams); err != nil {
+		t.Errorf("Equal parameters refused: %v", err)
+	}
+	stronger := KDFParams{Time: 4, Memory: 128 * 1024, Threads: 1}
+	if err := stronger.AtLeast(DefaultKDFParams); err != nil {
+		t.Errorf("Stronger parameters refused: %v", err)
+	}
+	for _, weaker := range []KDFParams{
+		{Time: 1, Memory: 64 * 1024, Threads: 4},
+		{Time: 3, Memory: 8 * 1024, Threads: 4},
+	} {
+		if err := weaker.AtLeast(DefaultKDFParams); err == nil {
+			t.Errorf("Weaker parameters %+v accepted", weaker)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation
+const listenFDsStart = 3
+
+// Listeners returns the sockets passed by systemd socket activation, or
+// none when the process was started directly. The activation variables
+// are cleared so child processes don't inherit them.
+func Listeners() ([]net.Listener, error) {
+	count, err := listenFDs(os.Getenv, os.Getpid())
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		listener, err := net.FileListener(f)
+		// FileListener duplicates the descriptor
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("inherited file descriptor %d is not a listening socket: %w", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listenFDs returns how many sockets were passed to process pid
+func listenFDs(getenv func(string) string, pid int) (int, error) {
+	pidText, fdsText := getenv("LISTEN_PID"), getenv("LISTEN_FDS")
+	if pidText == "" || fdsText == "" {
+		return 0, nil
+	}
+	// The variables were meant for another process, such as our parent
+	if target, err := strconv.Atoi(pidText); err != nil || target != pid {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(fdsText)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid LISTEN_FDS %q", fdsText)
+	}
+	return count, nil
+}
+
+// Notify sends a state such as "READY=1" to the service manager. It
+// reports false without error when not running under systemd.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading @ names a socket in the abstract namespace
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("error connecting to notify socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("error notifying service manager: %w", err)
+	}
+	return true, nil
+}
+
+// ErrRunning means the PID file names a process that is still running
+var ErrRunning = errors.New("already running")
+
+// WritePIDFile records the current process in path. It refuses to replace
+// the file of a process that is still running and returns a function that
+// removes the file.
+func WritePIDFile(path string) (func(), error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid != os.Getpid() && running(pid) {
+			return nil, fmt.Errorf("%w as process %d (PID file %s)", ErrRunning, pid, path)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	return func() { os.Remove(path) }, nil
+}
+
+// running reports whether a process with this pid exists
+func running(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestListenFDs(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		want    int
+		wantErr bool
+	}{
+		{"Not activated", map[string]string{}, 0, false},
+		{"Activated", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2"}, 2, false},
+		{"Meant for another process", map[string]string{"LISTEN_PID": "7", "LISTEN_FDS": "1"}, 0, false},
+		{"Malformed count", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "many"}, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			count, err := listenFDs(func(name string) string { return tc.env[name] }, 42)
+			if count != tc.want || (err != nil) != tc.wantErr {
+				t.Errorf("listenFDs = %d, %v; want %d, error %v", count, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	if sent, err := Notify("READY=1"); sent || err != nil {
+		t.Skip("NOTIFY_SOCKET is set in the test environment")
+	}
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("Unix datagram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if sent, err := Notify("READY=1"); !sent || err != nil {
+		t.Fatalf("Notify = %v, %v", sent, err)
+	}
+	buf := make([]byte, 64)
+	n, _ := conn.Read(buf)
+	if string(buf[:n]) != "READY=1" {
+		t.Errorf("Service manager received %q", buf[:n])
+	}
+}
+
+func TestWritePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "echo.pid")
+
+	remove, err := WritePIDFile(path)
+	if err != nil {
+		t.Fatalf("WritePIDFile failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Errorf("PID file contains %q", data)
+	}
+	remove()
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Error("PID file was not removed")
+	}
+
+	// A stale file from a process that exited is replaced
+	os.WriteFile(path, []byte("999999999\n"), 0644)
+	if _, err := WritePIDFile(path); err != nil {
+		t.Errorf("Stale PID file refused: %v", err)
+	}
+
+	// The parent process (the test runner) is still running
+	os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())), 0644)
+	if _, err := WritePIDFile(path); !errors.Is(err, ErrRunning) {
+		t.Errorf("Got %v, want ErrRunning", err)
+	}
+}
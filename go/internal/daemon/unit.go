@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ServiceName is the name of the generated systemd units
+const ServiceName = "secure-transfer"
+
+// Unit describes the systemd user units to generate
+type Unit struct {
+	// Command is the executable followed by its arguments
+	Command []string
+
+	// ListenStream, when set, is the address systemd listens on for
+	// socket activation; a .socket unit is generated alongside the service
+	ListenStream string
+}
+
+// Service returns the contents of the .service unit
+func (u Unit) Service() string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=secure-transfer echo server\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target\n")
+	if u.ListenStream != "" {
+		fmt.Fprintf(&b, "Requires=%s.socket\n", ServiceName)
+	}
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=notify\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", execLine(u.Command))
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n")
+	b.WriteString("NoNewPrivileges=yes\n")
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+	return b.String()
+}
+
+// Socket returns the contents of the .socket unit, empty without ListenStream
+func (u Unit) Socket() string {
+	if u.ListenStream == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=secure-transfer echo server socket\n")
+	b.WriteString("\n[Socket]\n")
+	fmt.Fprintf(&b, "ListenStream=%s\n", u.ListenStream)
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=sockets.target\n")
+	return b.String()
+}
+
+// UnitDir returns the directory systemd reads user units from
+func UnitDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "systemd", "user"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "systemd", "user"), nil
+}
+
+// Install writes the units to dir and returns the paths written
+func (u Unit) Install(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	units := map[string]string{ServiceName + ".service": u.Service()}
+	if socket := u.Socket(); socket != "" {
+		units[ServiceName+".socket"] = socket
+	}
+
+	var written []string
+	for _, name := range []string{ServiceName + ".service", ServiceName + ".socket"} {
+		content, ok := units[name]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// execLine quotes a command for ExecStart
+func execLine(command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteArg escapes an argument so systemd passes it through unchanged
+func quoteArg(arg string) string {
+	// % starts a specifier and $ a variable expansion
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestService(t *testing.T) {
+	unit := Unit{Command: []string{"/usr/bin/secure-transfer", "daemon", "--config-dir", "/home/me/my config", "--port", "9000"}}
+	service := unit.Service()
+
+	for _, want := range []string{
+		"Type=notify\n",
+		`ExecStart=/usr/bin/secure-transfer daemon --config-dir "/home/me/my config" --port 9000` + "\n",
+		"WantedBy=default.target\n",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("Service unit lacks %q:\n%s", want, service)
+		}
+	}
+	if strings.Contains(service, "Requires=") || unit.Socket() != "" {
+		t.Error("Socket unit generated without ListenStream")
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	testCases := map[string]string{
+		"plain":    "plain",
+		"":         `""`,
+		"100%":     "100%%",
+		"$HOME":    "$$HOME",
+		`say "hi"`: `"say \"hi\""`,
+		`C:\path`:  `"C:\\path"`,
+		"a;b":      `"a;b"`,
+	}
+	for arg, want := range testCases {
+		if got := quoteArg(arg); got != want {
+			t.Errorf("quoteArg(%q) = %s, want %s", arg, got, want)
+		}
+	}
+}
+
+func TestInstallWithSocket(t *testing.T) {
+	dir := t.TempDir()
+	unit := Unit{Command: []string{"/usr/bin/secure-transfer", "daemon"}, ListenStream: "0.0.0.0:8080"}
+
+	written, err := unit.Install(dir)
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("Wrote %v, want service and socket units", written)
+	}
+	socket, _ := os.ReadFile(filepath.Join(dir, ServiceName+".socket"))
+	if !strings.Contains(string(socket), "ListenStream=0.0.0.0:8080\n") {
+		t.Errorf("Socket unit:\n%s", socket)
+	}
+	service, _ := os.ReadFile(filepath.Join(dir, ServiceName+".service"))
+	if !strings.Contains(string(service), "Requires=secure-transfer.socket\n") {
+		t.Errorf("Service unit does not require the socket:\n%s", service)
+	}
+}
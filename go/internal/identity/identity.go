@@ -0,0 +1,271 @@
+package identity
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// keyType prefixes public keys in their text form
+const keyType = "ed25519"
+
+// Identity is the Ed25519 key pair identifying one installation
+type Identity struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+// Generate creates a new random identity
+func Generate() (*Identity, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{PrivateKey: privateKey}, nil
+}
+
+// LoadOrCreate reads the identity at path, generating and saving one if missing
+func LoadOrCreate(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		id, err := Generate()
+		if err != nil {
+			return nil, err
+		}
+		err = id.create(path)
+		if errors.Is(err, os.ErrExist) {
+			// Another process created one first, which both must share
+			return LoadOrCreate(path)
+		}
+		return id, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s does not hold an Ed25519 key", path)
+	}
+	return &Identity{PrivateKey: privateKey}, nil
+}
+
+// Save writes the private key to path readable only by the owner
+func (id *Identity) Save(path string) error {
+	data, err := id.encode()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// create saves the identity to path unless a file is already there. The
+// file appears complete or not at all, so processes starting together
+// never read a partial key or overwrite each other's.
+func (id *Identity) create(path string) error {
+	data, err := id.encode()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".identity-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Unlike rename, linking fails when path exists
+	return os.Link(tmp.Name(), path)
+}
+
+// encode returns the private key as PKCS #8 PEM
+func (id *Identity) encode() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(id.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// PublicKey returns the public half of the identity
+func (id *Identity) PublicKey() ed25519.PublicKey {
+	return id.PrivateKey.Public().(ed25519.PublicKey)
+}
+
+// Sign signs message with the identity key
+func (id *Identity) Sign(message []byte) []byte {
+	return ed25519.Sign(id.PrivateKey, message)
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a public key
+func Fingerprint(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// FormatPublicKey renders a public key as "ed25519 <base64>"
+func FormatPublicKey(publicKey ed25519.PublicKey) string {
+	return keyType + " " + base64.StdEncoding.EncodeToString(publicKey)
+}
+
+// ParsePublicKey parses the output of FormatPublicKey; the type prefix is optional
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	encoded := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), keyType+" "))
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key length %d", len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Peer is an entry in the authorized peers file
+type Peer struct {
+	Name      string
+	PublicKey ed25519.PublicKey
+}
+
+// Fingerprint returns the fingerprint of the peer's key
+func (p Peer) Fingerprint() string {
+	return Fingerprint(p.PublicKey)
+}
+
+// LoadPeers reads an authorized peers file of "ed25519 <base64> <name>" lines.
+// A missing file yields no peers and no error.
+func LoadPeers(path string) ([]Peer, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var peers []Peer
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != keyType {
+			return nil, fmt.Errorf("malformed authorized peers line %q", line)
+		}
+		publicKey, err := ParsePublicKey(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, Peer{Name: strings.Join(fields[2:], " "), PublicKey: publicKey})
+	}
+	return peers, scanner.Err()
+}
+
+// LoadAllowList reads the authorized peers file as receivers apply it.
+// enforced is false when the file is missing or lists no peers, in which
+// case any sender holding the key is accepted.
+func LoadAllowList(path string) (peers []Peer, enforced bool, err error) {
+	peers, err = LoadPeers(path)
+	if err != nil {
+		return nil, false, err
+	}
+	return peers, len(peers) > 0, nil
+}
+
+// SavePeers writes peers to path, replacing its contents
+func SavePeers(path string, peers []Peer) error {
+	var buf bytes.Buffer
+	for _, peer := range peers {
+		fmt.Fprintf(&buf, "%s %s\n", FormatPublicKey(peer.PublicKey), peer.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// AddPeer appends a peer to the file, refusing duplicate names or keys
+func AddPeer(path string, peer Peer) error {
+	if peer.Name == "" || strings.ContainsAny(peer.Name, "\n\r") {
+		return fmt.Errorf("invalid peer name %q", peer.Name)
+	}
+	peers, err := LoadPeers(path)
+	if err != nil {
+		return err
+	}
+	for _, existing := range peers {
+		if existing.Name == peer.Name {
+			return fmt.Errorf("peer %q already exists", peer.Name)
+		}
+		if existing.PublicKey.Equal(peer.PublicKey) {
+			return fmt.Errorf("key already trusted as %q", existing.Name)
+		}
+	}
+	return SavePeers(path, append(peers, peer))
+}
+
+// RemovePeer removes the peer matching a name or fingerprint, deleting
+// the file along with the last peer
+func RemovePeer(path string, nameOrFingerprint string) error {
+	peers, err := LoadPeers(path)
+	if err != nil {
+		return err
+	}
+	kept := peers[:0]
+	for _, peer := range peers {
+		if peer.Name != nameOrFingerprint && peer.Fingerprint() != nameOrFingerprint {
+			kept = append(kept, peer)
+		}
+	}
+	if len(kept) == len(peers) {
+		return fmt.Errorf("no peer matching %q", nameOrFingerprint)
+	}
+	if len(kept) == 0 {
+		// No file and an empty file both mean no allow-list; removing
+		// it leaves no doubt
+		return os.Remove(path)
+	}
+	return SavePeers(path, kept)
+}
+
+// FindPeer returns the peer holding publicKey
+func FindPeer(peers []Peer, publicKey ed25519.PublicKey) (Peer, bool) {
+	for _, peer := range peers {
+		if peer.PublicKey.Equal(publicKey) {
+			return peer, true
+		}
+	}
+	return Peer{}, false
+}
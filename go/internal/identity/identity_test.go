@@ -0,0 +1,160 @@
+package identity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLoadOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.pem")
+
+	first, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	second, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("Failed to load identity: %v", err)
+	}
+	if !first.PublicKey().Equal(second.PublicKey()) {
+		t.Error("Identity was regenerated instead of loaded")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Identity file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Identity file permissions = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestLoadOrCreateConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.pem")
+
+	ids := make([]*Identity, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := LoadOrCreate(path)
+			if err != nil {
+				t.Errorf("LoadOrCreate failed: %v", err)
+				return
+			}
+			ids[i] = id
+		}()
+	}
+	wg.Wait()
+
+	saved, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("Failed to load identity: %v", err)
+	}
+	for i, id := range ids {
+		if id != nil && !id.PublicKey().Equal(saved.PublicKey()) {
+			t.Errorf("Caller %d got an identity other than the saved one", i)
+		}
+	}
+}
+
+func TestPublicKeyRoundTrip(t *testing.T) {
+	id, err := Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	parsed, err := ParsePublicKey(FormatPublicKey(id.PublicKey()))
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %v", err)
+	}
+	if !parsed.Equal(id.PublicKey()) {
+		t.Error("Parsed key doesn't match original")
+	}
+
+	if _, err := ParsePublicKey("ed25519 c2hvcnQ="); err == nil {
+		t.Error("Expected error for short key")
+	}
+}
+
+func TestAuthorizedPeers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorized_peers")
+
+	alice, _ := Generate()
+	bob, _ := Generate()
+
+	if err := AddPeer(path, Peer{Name: "alice laptop", PublicKey: alice.PublicKey()}); err != nil {
+		t.Fatalf("Failed to add alice: %v", err)
+	}
+	if err := AddPeer(path, Peer{Name: "bob", PublicKey: bob.PublicKey()}); err != nil {
+		t.Fatalf("Failed to add bob: %v", err)
+	}
+	if err := AddPeer(path, Peer{Name: "alice again", PublicKey: alice.PublicKey()}); err == nil {
+		t.Error("Expected duplicate key to be refused")
+	}
+
+	peers, err := LoadPeers(path)
+	if err != nil {
+		t.Fatalf("Failed to load peers: %v", err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("Got %d peers, want 2", len(peers))
+	}
+	if peer, ok := FindPeer(peers, alice.PublicKey()); !ok || peer.Name != "alice laptop" {
+		t.Errorf("FindPeer(alice) = %q, %v", peer.Name, ok)
+	}
+
+	if err := RemovePeer(path, Fingerprint(alice.PublicKey())); err != nil {
+		t.Fatalf("Failed to remove by fingerprint: %v", err)
+	}
+	if err := RemovePeer(path, "bob"); err != nil {
+		t.Fatalf("Failed to remove by name: %v", err)
+	}
+	if err := RemovePeer(path, "bob"); err == nil {
+		t.Error("Expected removing an unknown peer to fail")
+	}
+
+	peers, err = LoadPeers(path)
+	if err != nil {
+		t.Fatalf("Failed to load peers: %v", err)
+	}
+	if len(peers) != 0 {
+		t.Errorf("Got %d peers after removal, want 0", len(peers))
+	}
+}
+
+func TestAllowListAfterLastPeerRemoved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "authorized_peers")
+	alice, _ := Generate()
+
+	if _, enforced, err := LoadAllowList(path); err != nil || enforced {
+		t.Errorf("Missing file: enforced %v, %v", enforced, err)
+	}
+	if err := AddPeer(path, Peer{Name: "alice", PublicKey: alice.PublicKey()}); err != nil {
+		t.Fatalf("Failed to add alice: %v", err)
+	}
+	if peers, enforced, err := LoadAllowList(path); err != nil || !enforced || len(peers) != 1 {
+		t.Errorf("One peer: %d peers, enforced %v, %v", len(peers), enforced, err)
+	}
+
+	if err := RemovePeer(path, "alice"); err != nil {
+		t.Fatalf("Failed to remove alice: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("File left behind after removing the last peer: %v", err)
+	}
+	if _, enforced, err := LoadAllowList(path); err != nil || enforced {
+		t.Errorf("After removing the last peer: enforced %v, %v", enforced, err)
+	}
+
+	// An empty file, as older versions left behind, is not an allow-list
+	if err := os.WriteFile(path, []byte("# nobody yet\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, enforced, err := LoadAllowList(path); err != nil || enforced {
+		t.Errorf("Empty file: enforced %v, %v", enforced, err)
+	}
+}
@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Formats understood by NewHandler
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel parses a log level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	switch name {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+}
+
+// NewHandler returns a handler writing records to w in format
+func NewHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case FormatText:
+		return slog.NewTextHandler(w, opts), nil
+	case FormatJSON:
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+}
+
+// RotatingFile is a log file that is rotated once it reaches a size limit.
+// Rotated files are renamed to path.1, path.2 and so on, oldest last, and
+// only the most recent ones are kept.
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	// errOut receives the first error of failing rotations
+	errOut io.Writer
+
+	mu           sync.Mutex
+	file         *os.File
+	size         int64
+	rotateFailed bool
+}
+
+// OpenRotatingFile opens path for appending, rotating it when a write would
+// take it past maxSize bytes and keeping at most maxFiles rotated files.
+// A maxSize of zero disables rotation.
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles, errOut: os.Stderr}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p, rotating first if p would not fit in the current file.
+// When rotation fails p goes to the current file, and the failure is
+// reported to stderr once until a rotation succeeds.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			if !f.rotateFailed {
+				fmt.Fprintf(f.errOut, "Log rotation of %s failed, writing on to the current file: %v\n", f.path, err)
+			}
+			f.rotateFailed = true
+		} else {
+			f.rotateFailed = false
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// open opens the log file for appending, noting its current size. The
+// file in use is only replaced once the new one is open.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and
+// starts a new file. The current file stays open throughout, so writes
+// carry on to it if any step fails.
+func (f *RotatingFile) rotate() error {
+	if f.maxFiles <= 0 {
+		if err := f.file.Truncate(0); err != nil {
+			return err
+		}
+		f.size = 0
+		return nil
+	}
+	os.Remove(f.rotated(f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		os.Rename(f.rotated(i), f.rotated(i+1))
+	}
+	// Missing after an earlier rotation renamed it but failed to reopen
+	if err := os.Rename(f.path, f.rotated(1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return f.open()
+}
+
+// rotated returns the name of the n-th rotated file
+func (f *RotatingFile) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewHandlerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := NewHandler(&buf, FormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(handler)
+	logger.Debug("Hidden")
+	logger.Info("File sent", "peer", "10.0.0.1:8080", "bytes", 42)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Output is not one JSON record: %v: %s", err, buf.String())
+	}
+	if record["msg"] != "File sent" || record["peer"] != "10.0.0.1:8080" || record["bytes"] != float64(42) {
+		t.Errorf("Unexpected record %v", record)
+	}
+
+	if _, err := NewHandler(&buf, "xml", slog.LevelInfo); err == nil {
+		t.Error("Unknown format accepted")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("warn"); err != nil || level != slog.LevelWarn {
+		t.Errorf("ParseLevel(warn) = %v, %v", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Unknown level accepted")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "transfer.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Missing %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", name, data, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("More rotated files kept than configured")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Log file permissions = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestFailedRotationKeepsLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transfer.log")
+	f, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	defer f.Close()
+	var errOut bytes.Buffer
+	f.errOut = &errOut
+
+	// A directory in the way of the rotated file makes rotation fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "in-the-way"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed after a failed rotation: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first\nsecond\nthird\n" {
+		t.Errorf("Log = %q, want every line", data)
+	}
+	if n := strings.Count(errOut.String(), "rotation"); n != 1 {
+		t.Errorf("Rotation failure reported %d times: %q", n, errOut.String())
+	}
+
+	os.RemoveAll(path + ".1")
+	f.Write([]byte("fourth\n"))
+	if data, _ := os.ReadFile(path); string(data) != "fourth\n" {
+		t.Errorf("Log after recovery = %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "first\nsecond\nthird\n" {
+		t.Errorf("Rotated log after recovery = %q", data)
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transfer.log")
+	for range 2 {
+		f, err := OpenRotatingFile(path, 0, 0)
+		if err != nil {
+			t.Fatalf("Failed to open log file: %v", err)
+		}
+		f.Write([]byte("line\n"))
+		f.Close()
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "line") != 2 {
+		t.Errorf("Reopening truncated the log: %q", data)
+	}
+}
@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds metrics and renders them in the Prometheus text format.
+// All metric methods are safe on nil receivers, so instrumented code runs
+// unchanged when metrics are disabled.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// metric is one registered metric family
+type metric interface {
+	write(w io.Writer)
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics for scraping
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// Counter is a monotonically increasing count
+type Counter struct {
+	name, help string
+	value      atomic.Uint64
+}
+
+// Counter registers a counter
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	r.register(c)
+	return c
+}
+
+// Inc adds one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds n
+func (c *Counter) Add(n uint64) {
+	if c != nil {
+		c.value.Add(n)
+	}
+}
+
+// Value returns the current count
+func (c *Counter) Value() uint64 {
+	if c == nil {
+		return 0
+	}
+	return c.value.Load()
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+// CounterVec is a counter partitioned by the value of one label
+type CounterVec struct {
+	name, help, label string
+
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// CounterVec registers a counter partitioned by label
+func (r *Registry) CounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{name: name, help: help, label: label, counters: make(map[string]*Counter)}
+	r.register(v)
+	return v
+}
+
+// With returns the counter for one label value
+func (v *CounterVec) With(value string) *Counter {
+	if v == nil {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.counters[value]
+	if !ok {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) write(w io.Writer) {
+	writeHeader(w, v.name, v.help, "counter")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, value := range sortedKeys(v.counters) {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", v.name, v.label, value, v.counters[value].Value())
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	name, help string
+	value      atomic.Int64
+}
+
+// Gauge registers a gauge
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(g)
+	return g
+}
+
+// Add adds n, which may be negative
+func (g *Gauge) Add(n int64) {
+	if g != nil {
+		g.value.Add(n)
+	}
+}
+
+// Value returns the current value
+func (g *Gauge) Value() int64 {
+	if g == nil {
+		return 0
+	}
+	return g.value.Load()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %d\n", g.name, g.Value())
+}
+
+// DefaultBuckets suit durations in seconds from milliseconds to a minute
+var DefaultBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe records one value
+func (h *Histogram) Observe(value float64) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// writeSeries writes the bucket, sum and count lines; labels is either
+// empty or a `name="value",` prefix
+func (h *Histogram) writeSeries(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	braces := ""
+	if labels != "" {
+		braces = "{" + labels[:len(labels)-1] + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, braces, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, braces, h.count)
+}
+
+// HistogramVec is a histogram partitioned by the value of one label
+type HistogramVec struct {
+	name, help, label string
+	buckets           []float64
+
+	mu         sync.Mutex
+	histograms map[string]*Histogram
+}
+
+// HistogramVec registers a histogram partitioned by label
+func (r *Registry) HistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	v := &HistogramVec{name: name, help: help, label: label, buckets: buckets, histograms: make(map[string]*Histogram)}
+	r.register(v)
+	return v
+}
+
+// With returns the histogram for one label value
+func (v *HistogramVec) With(value string) *Histogram {
+	if v == nil {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.histograms[value]
+	if !ok {
+		h = newHistogram(v.buckets)
+		v.histograms[value] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) write(w io.Writer) {
+	writeHeader(w, v.name, v.help, "histogram")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, value := range sortedKeys(v.histograms) {
+		v.histograms[value].writeSeries(w, v.name, fmt.Sprintf("%s=%q,", v.label, value))
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
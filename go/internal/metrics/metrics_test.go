@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	accepted := reg.Counter("test_accepted_total", "Connections accepted")
+	rejected := reg.CounterVec("test_rejected_total", "Connections rejected", "reason")
+	active := reg.Gauge("test_active", "Open connections")
+	duration := reg.HistogramVec("test_duration_seconds", "Transfer time", "direction", []float64{0.1, 1})
+
+	accepted.Add(3)
+	rejected.With("rate").Inc()
+	rejected.With("acl").Add(2)
+	active.Add(2)
+	active.Add(-1)
+	duration.With("receive").Observe(0.05)
+	duration.With("receive").Observe(0.5)
+	duration.With("receive").Observe(2)
+
+	var out strings.Builder
+	if err := reg.WriteText(&out); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	text := out.String()
+
+	for _, want := range []string{
+		"# TYPE test_accepted_total counter\ntest_accepted_total 3\n",
+		"test_rejected_total{reason=\"acl\"} 2\ntest_rejected_total{reason=\"rate\"} 1\n",
+		"# TYPE test_active gauge\ntest_active 1\n",
+		"# TYPE test_duration_seconds histogram\n",
+		"test_duration_seconds_bucket{direction=\"receive\",le=\"0.1\"} 1\n",
+		"test_duration_seconds_bucket{direction=\"receive\",le=\"1\"} 2\n",
+		"test_duration_seconds_bucket{direction=\"receive\",le=\"+Inf\"} 3\n",
+		"test_duration_seconds_sum{direction=\"receive\"} 2.55\n",
+		"test_duration_seconds_count{direction=\"receive\"} 3\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Output lacks %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestNilMetricsAreNoOps(t *testing.T) {
+	var c *Counter
+	var v *CounterVec
+	var g *Gauge
+	var h *HistogramVec
+
+	c.Inc()
+	v.With("x").Inc()
+	g.Add(1)
+	h.With("x").Observe(1)
+
+	if c.Value() != 0 || g.Value() != 0 || h.With("x").Count() != 0 {
+		t.Error("Nil metrics should read as zero")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("test_total", "A counter").Inc()
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "test_total 1") {
+		t.Errorf("Body = %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend names accepted by --notify
+const (
+	BackendAuto       = "auto"
+	BackendNotifySend = "notify-send"
+	BackendDBus       = "dbus"
+	BackendTermux     = "termux"
+	BackendNone       = "none"
+)
+
+// commandTimeout bounds how long a notification command may run
+const commandTimeout = 5 * time.Second
+
+// Notification describes a received item
+type Notification struct {
+	// Sender is the peer's name, or its fingerprint when it has none
+	Sender string
+
+	// Type is "message" or "file"
+	Type string
+	Size int
+
+	// Preview is the start of the content, empty to show none
+	Preview string
+
+	// Path is where a file was saved
+	Path string
+
+	// Copied reports whether the content is on the clipboard
+	Copied bool
+}
+
+// Title returns the notification's headline
+func (n Notification) Title() string {
+	kind := "Message"
+	if n.Type == "file" {
+		kind = "File"
+	}
+	return kind + " from " + n.Sender
+}
+
+// Body returns the notification's text
+func (n Notification) Body() string {
+	lines := []string{fmt.Sprintf("%d bytes", n.Size)}
+	if n.Path != "" {
+		lines[0] += " saved as " + n.Path
+	}
+	if n.Copied {
+		lines[0] += ", copied to the clipboard"
+	}
+	if n.Preview != "" {
+		lines = append(lines, n.Preview)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Notifier tells the user about a received item
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Validate checks backend is one of the backend names
+func Validate(backend string) error {
+	switch backend {
+	case BackendAuto, BackendNotifySend, BackendDBus, BackendTermux, BackendNone:
+		return nil
+	}
+	return fmt.Errorf("unknown notification backend %q (want auto, notify-send, dbus, termux or none)", backend)
+}
+
+// New returns the notifier for backend. BackendAuto picks the first
+// backend whose command is installed, or none.
+func New(backend string) (Notifier, error) {
+	if err := Validate(backend); err != nil {
+		return nil, err
+	}
+	if backend == BackendAuto {
+		backend = detect(exec.LookPath)
+	}
+	switch backend {
+	case BackendNotifySend:
+		return NotifySend{}, nil
+	case BackendDBus:
+		return DBus{}, nil
+	case BackendTermux:
+		return Termux{}, nil
+	}
+	return Nop{}, nil
+}
+
+// detect returns the backend suited to this system
+func detect(lookPath func(string) (string, error)) string {
+	installed := func(command string) bool {
+		_, err := lookPath(command)
+		return err == nil
+	}
+	switch {
+	case installed("termux-notification"):
+		return BackendTermux
+	case runtime.GOOS != "linux" && runtime.GOOS != "freebsd":
+		return BackendNone
+	case installed("notify-send"):
+		return BackendNotifySend
+	case installed("gdbus") && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "":
+		return BackendDBus
+	}
+	return BackendNone
+}
+
+// run executes a notification command, bounded by commandTimeout
+func run(name string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		if text := strings.TrimSpace(string(out)); text != "" {
+			return fmt.Errorf("%s: %w: %s", name, err, text)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// NotifySend shows desktop notifications with libnotify's notify-send
+type NotifySend struct {
+	// Command is the executable; "notify-send" when empty
+	Command string
+}
+
+// Notify runs notify-send with the notification's title and body
+func (s NotifySend) Notify(n Notification) error {
+	command := s.Command
+	if command == "" {
+		command = "notify-send"
+	}
+	return run(command, "--app-name=secure-transfer", "--", n.Title(), n.Body())
+}
+
+// DBus calls the freedesktop notification service on the session bus
+// directly, for desktops without notify-send
+type DBus struct {
+	// Command is the gdbus executable; "gdbus" when empty
+	Command string
+}
+
+// Notify sends the notification to the session bus with gdbus
+func (d DBus) Notify(n Notification) error {
+	command := d.Command
+	if command == "" {
+		command = "gdbus"
+	}
+	return run(command, "call", "--session",
+		"--dest=org.freedesktop.Notifications",
+		"--object-path=/org/freedesktop/Notifications",
+		"--method=org.freedesktop.Notifications.Notify",
+		// app_name, replaces_id, app_icon, summary, body, actions, hints, timeout
+		gvariantString("secure-transfer"), "uint32 0", gvariantString(""),
+		gvariantString(n.Title()), gvariantString(n.Body()), "@as []", "@a{sv} {}", "int32 -1")
+}
+
+// gvariantString quotes s in GVariant text format
+func gvariantString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return "'" + s + "'"
+}
+
+// Termux posts Android notifications through the Termux:API add-on
+type Termux struct {
+	// Command is the executable; "termux-notification" when empty
+	Command string
+}
+
+// Notify posts the notification with termux-notification
+func (t Termux) Notify(n Notification) error {
+	command := t.Command
+	if command == "" {
+		command = "termux-notification"
+	}
+	return run(command, "--group", "secure-transfer", "--title", n.Title(), "--content", n.Body())
+}
+
+// Nop discards notifications
+type Nop struct{}
+
+// Notify does nothing
+func (Nop) Notify(Notification) error { return nil }
+
+// Recorder keeps the notifications it is given, for tests
+type Recorder struct {
+	mu            sync.Mutex
+	notifications []Notification
+}
+
+// Notify records n
+func (r *Recorder) Notify(n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, n)
+	return nil
+}
+
+// Notifications returns what was recorded so far
+func (r *Recorder) Notifications() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Notification(nil), r.notifications...)
+}
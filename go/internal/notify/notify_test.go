@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNotificationText(t *testing.T) {
+	n := Notification{Sender: "laptop", Type: "file", Size: 12, Path: "/tmp/a.txt", Copied: true, Preview: "hello"}
+	if got := n.Title(); got != "File from laptop" {
+		t.Errorf("Title = %q", got)
+	}
+	if got, want := n.Body(), "12 bytes saved as /tmp/a.txt, copied to the clipboard\nhello"; got != want {
+		t.Errorf("Body = %q, want %q", got, want)
+	}
+
+	n = Notification{Sender: "SHA256:abc", Type: "message", Size: 3}
+	if n.Title() != "Message from SHA256:abc" || n.Body() != "3 bytes" {
+		t.Errorf("Message notification = %q, %q", n.Title(), n.Body())
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("growl"); err == nil {
+		t.Error("Unknown backend accepted")
+	}
+	for backend, want := range map[string]Notifier{
+		BackendNotifySend: NotifySend{},
+		BackendDBus:       DBus{},
+		BackendTermux:     Termux{},
+		BackendNone:       Nop{},
+	} {
+		if got, err := New(backend); err != nil || got != want {
+			t.Errorf("New(%q) = %#v, %v", backend, got, err)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	lookPath := func(installed ...string) func(string) (string, error) {
+		return func(command string) (string, error) {
+			if slices.Contains(installed, command) {
+				return "/usr/bin/" + command, nil
+			}
+			return "", errors.New("not found")
+		}
+	}
+	if got := detect(lookPath("termux-notification", "notify-send")); got != BackendTermux {
+		t.Errorf("Termux detected as %q", got)
+	}
+	if got := detect(lookPath()); got != BackendNone {
+		t.Errorf("Nothing installed detected as %q", got)
+	}
+	if runtime.GOOS == "linux" {
+		if got := detect(lookPath("notify-send", "gdbus")); got != BackendNotifySend {
+			t.Errorf("notify-send detected as %q", got)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake notification commands are shell scripts")
+	}
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "notifier")
+	os.WriteFile(script, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > "+args+"\n"), 0755)
+	n := Notification{Sender: "phone", Type: "message", Size: 5, Preview: "it's"}
+
+	for _, tt := range []struct {
+		notifier Notifier
+		want     []string
+	}{
+		{NotifySend{Command: script}, []string{"--app-name=secure-transfer", "--", "Message from phone", "5 bytes", "it's"}},
+		{Termux{Command: script}, []string{"--group", "secure-transfer", "--title", "Message from phone", "--content", "5 bytes", "it's"}},
+		{DBus{Command: script}, []string{"call", "--session", "--dest=org.freedesktop.Notifications",
+			"--object-path=/org/freedesktop/Notifications", "--method=org.freedesktop.Notifications.Notify",
+			"'secure-transfer'", "uint32 0", "''", "'Message from phone'", `'5 bytes\nit\'s'`, "@as []", "@a{sv} {}", "int32 -1"}},
+	} {
+		if err := tt.notifier.Notify(n); err != nil {
+			t.Fatalf("%T: %v", tt.notifier, err)
+		}
+		data, _ := os.ReadFile(args)
+		if got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"); !slices.Equal(got, tt.want) {
+			t.Errorf("%T ran with %q, want %q", tt.notifier, got, tt.want)
+		}
+	}
+
+	if err := (NotifySend{Command: filepath.Join(dir, "missing")}).Notify(n); err == nil {
+		t.Error("Missing command reported no error")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := &Recorder{}
+	r.Notify(Notification{Sender: "a"})
+	r.Notify(Notification{Sender: "b"})
+	if got := r.Notifications(); len(got) != 2 || got[1].Sender != "b" {
+		t.Errorf("Recorded %+v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package transfer
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// AccessList decides which remote addresses may connect. A deny match
+// always wins; when Allow is non-empty the address must also match it.
+type AccessList struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// ParseAccessList parses CIDR ranges or single addresses
+func ParseAccessList(allow, deny []string) (AccessList, error) {
+	var acl AccessList
+	var err error
+	if acl.Allow, err = parsePrefixes(allow); err != nil {
+		return AccessList{}, fmt.Errorf("invalid allow entry: %w", err)
+	}
+	if acl.Deny, err = parsePrefixes(deny); err != nil {
+		return AccessList{}, fmt.Errorf("invalid deny entry: %w", err)
+	}
+	return acl, nil
+}
+
+// parsePrefixes parses each entry as a CIDR, treating a bare address as a
+// single-host range
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Permits reports whether addr may connect
+func (a AccessList) Permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range a.Deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(a.Allow) == 0 {
+		return true
+	}
+	for _, prefix := range a.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// permitsConn checks a connection's remote address against the list
+func (a AccessList) permitsConn(conn net.Conn) bool {
+	if len(a.Allow) == 0 && len(a.Deny) == 0 {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		// Refuse what cannot be checked
+		return false
+	}
+	return a.Permits(addrPort.Addr())
+}
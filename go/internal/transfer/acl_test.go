@@ -0,0 +1,85 @@
+package transfer
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestAccessList(t *testing.T) {
+	acl, err := ParseAccessList([]string{"192.168.1.0/24", "10.0.0.5", "fd00::/8"}, []string{"192.168.1.13"})
+	if err != nil {
+		t.Fatalf("Failed to parse access list: %v", err)
+	}
+
+	testCases := []struct {
+		addr string
+		want bool
+	}{
+		{"192.168.1.20", true},
+		{"192.168.1.13", false},
+		{"10.0.0.5", true},
+		{"10.0.0.6", false},
+		{"::ffff:192.168.1.20", true},
+		{"fd12::1", true},
+		{"2001:db8::1", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			if got := acl.Permits(netip.MustParseAddr(tc.addr)); got != tc.want {
+				t.Errorf("Permits(%s) = %v, want %v", tc.addr, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAccessListDenyOnly(t *testing.T) {
+	acl, err := ParseAccessList(nil, []string{"203.0.113.0/24"})
+	if err != nil {
+		t.Fatalf("Failed to parse access list: %v", err)
+	}
+	if !acl.Permits(netip.MustParseAddr("198.51.100.1")) {
+		t.Error("Addresses outside the deny list should be allowed")
+	}
+	if acl.Permits(netip.MustParseAddr("203.0.113.9")) {
+		t.Error("Denied range should be refused")
+	}
+}
+
+func TestParseAccessListErrors(t *testing.T) {
+	for _, entry := range []string{"192.168.1.0/33", "not-an-ip", "10.0.0.0/"} {
+		if _, err := ParseAccessList([]string{entry}, nil); err == nil {
+			t.Errorf("Expected %q to be rejected", entry)
+		}
+	}
+}
+
+func TestAccessListConn(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	defer conn.Close()
+
+	deny, _ := ParseAccessList(nil, []string{"127.0.0.0/8"})
+	if deny.permitsConn(conn) {
+		t.Error("Loopback connection should be denied")
+	}
+	allow, _ := ParseAccessList([]string{"127.0.0.1"}, nil)
+	if !allow.permitsConn(conn) {
+		t.Error("Loopback connection should be allowed")
+	}
+}
@@ -0,0 +1,98 @@
+package transfer
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// previewLength is the number of characters of content shown for approval
+// and in notifications
+const previewLength = 80
+
+// responseRejected answers a message the receiver declined
+const responseRejected = "Rejected by receiver"
+
+// Pending is a received item held until it is approved
+type Pending struct {
+	// ID is assigned by the Approver
+	ID          uint64    `json:"id"`
+	Time        time.Time `json:"time"`
+	Remote      string    `json:"remote"`
+	Peer        string    `json:"peer,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	Type        string    `json:"type"`
+	Size        int       `json:"size"`
+	Preview     string    `json:"preview"`
+}
+
+// Sender returns the peer's name, or its fingerprint when it has none
+func (p Pending) Sender() string {
+	if p.Peer != "" {
+		return p.Peer
+	}
+	return p.Fingerprint
+}
+
+// Approver decides whether a received item is saved or copied. Approve
+// blocks until a decision is made.
+type Approver interface {
+	Approve(item Pending) bool
+}
+
+// Approval holds received items for an Approver
+type Approval struct {
+	Approver Approver
+
+	// Trusted lists the peers, by name or fingerprint, whose items are
+	// accepted without asking
+	Trusted []string
+}
+
+// approve asks whether to apply a received item; everything is accepted
+// when a is nil
+func (a *Approval) approve(conn net.Conn, sess session, transferType string, data []byte) bool {
+	if a == nil || a.Approver == nil {
+		return true
+	}
+	if slices.Contains(a.Trusted, sess.peer.Fingerprint()) || (sess.peer.Name != "" && slices.Contains(a.Trusted, sess.peer.Name)) {
+		return true
+	}
+	return a.Approver.Approve(Pending{
+		Time:        time.Now(),
+		Remote:      conn.RemoteAddr().String(),
+		Peer:        sess.peer.Name,
+		Fingerprint: sess.peer.Fingerprint(),
+		Type:        transferType,
+		Size:        len(data),
+		Preview:     preview(data),
+	})
+}
+
+// preview returns the start of data as a single line of printable text
+func preview(data []byte) string {
+	if !utf8.Valid(data) {
+		return "(binary data)"
+	}
+	text := []rune(string(data))
+	truncated := len(text) > previewLength
+	if truncated {
+		text = text[:previewLength]
+	}
+	line := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if !unicode.IsPrint(r) {
+			return '?'
+		}
+		return r
+	}, string(text))
+	if truncated {
+		line += "..."
+	}
+	return line
+}
@@ -0,0 +1,92 @@
+package transfer
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/identity"
+)
+
+// answer approves or rejects every item and records what it was asked
+type answer struct {
+	accept bool
+
+	mu    sync.Mutex
+	asked []Pending
+}
+
+func (a *answer) Approve(item Pending) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.asked = append(a.asked, item)
+	return a.accept
+}
+
+func (a *answer) questions() []Pending {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.asked)
+}
+
+func TestApproval(t *testing.T) {
+	logger := testLogger(t)
+	key, _ := crypto.GenerateKey()
+	trusted, _ := identity.Generate()
+	stranger, _ := identity.Generate()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	approver := &answer{}
+	history := NewHistory(10)
+	opts := Options{
+		Clipboard: ClipboardNever,
+		History:   history,
+		Approval: &Approval{
+			Approver: approver,
+			Trusted:  []string{identity.Fingerprint(trusted.PublicKey())},
+		},
+	}
+	go ServeEcho(listener, key, opts, logger)
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	err = SendMessage("127.0.0.1", port, "", "unwanted\nsecond line", key, Options{Identity: stranger}, logger)
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("Rejected message returned %v, want ErrRejected", err)
+	}
+	if asked := approver.questions(); len(asked) != 1 || asked[0].Preview != "unwanted second line" {
+		t.Errorf("Approver asked about %+v", asked)
+	}
+
+	if err := SendMessage("127.0.0.1", port, "", "from a friend", key, Options{Identity: trusted}, logger); err != nil {
+		t.Errorf("Trusted peer's message failed: %v", err)
+	}
+	if len(approver.questions()) != 1 {
+		t.Error("Approver asked about a trusted peer's message")
+	}
+	if recent := history.Recent(0); len(recent) != 1 || recent[0].Content != "from a friend" {
+		t.Errorf("History = %+v, want only the accepted message", recent)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	testCases := map[string]string{
+		"short":                    "short",
+		"tab\tand\nnewline":        "tab and newline",
+		"bell\a":                   "bell?",
+		strings.Repeat("x", 100):   strings.Repeat("x", previewLength) + "...",
+		string([]byte{0xff, 0xfe}): "(binary data)",
+	}
+	for data, want := range testCases {
+		if got := preview([]byte(data)); got != want {
+			t.Errorf("preview(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
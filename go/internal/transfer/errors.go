@@ -0,0 +1,69 @@
+package transfer
+
+import (
+	"errors"
+
+	"secure-transfer/internal/clipboard"
+)
+
+// Failure categories of the transfer functions, to be tested with errors.Is
+var (
+	// ErrAuthFailed means the peer failed to prove its identity or is not
+	// an authorized peer
+	ErrAuthFailed = errors.New("authentication failed")
+
+	// ErrProtocol means the peers could not agree on how to transfer: a
+	// different protocol version, transfer type, cipher, compression or
+	// passphrase setting, or a malformed handshake
+	ErrProtocol = errors.New("protocol mismatch")
+
+	// ErrReplayed means the receiver refused a handshake it had already
+	// seen or whose timestamp fell outside its window, which for a
+	// genuine sender usually means the clocks disagree
+	ErrReplayed = errors.New("rejected as a replay")
+
+	// ErrPeerUnreachable means no connection to the peer could be made
+	ErrPeerUnreachable = errors.New("peer unreachable")
+
+	// ErrIntegrity means received data failed to decrypt or authenticate,
+	// usually because of a wrong key or tampering in transit
+	ErrIntegrity = errors.New("integrity check failed")
+
+	// ErrTooLarge means a payload exceeds what the receiver accepts
+	ErrTooLarge = errors.New("payload too large")
+
+	// ErrRejected means the receiver declined the item when asked to
+	// approve it
+	ErrRejected = errors.New("rejected by receiver")
+
+	// ErrClipboardUnavailable means received content could not be copied
+	// to the clipboard
+	ErrClipboardUnavailable = clipboard.ErrUnavailable
+)
+
+// refusals names the failure categories a receiver reports when refusing
+// a handshake, so the sender fails with the same one
+var refusals = map[string]error{
+	"auth":     ErrAuthFailed,
+	"protocol": ErrProtocol,
+	"replay":   ErrReplayed,
+}
+
+// refusalName returns the name refusals knows class by
+func refusalName(class error) string {
+	for name, err := range refusals {
+		if err == class {
+			return name
+		}
+	}
+	return ""
+}
+
+// refusalClass returns the category a receiver refused with. Receivers
+// that give none are taken to have refused authentication.
+func refusalClass(name string) error {
+	if class, ok := refusals[name]; ok {
+		return class
+	}
+	return ErrAuthFailed
+}
@@ -0,0 +1,95 @@
+package transfer
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/identity"
+)
+
+func TestErrorCategories(t *testing.T) {
+	logger := testLogger(t)
+	key, _ := crypto.GenerateKey()
+
+	t.Run("Peer unreachable", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		err := SendMessage("127.0.0.1", port, "", "hello", key, Options{}, logger)
+		if !errors.Is(err, ErrPeerUnreachable) {
+			t.Errorf("Got %v, want ErrPeerUnreachable", err)
+		}
+	})
+
+	t.Run("Auth failed", func(t *testing.T) {
+		peersFile := filepath.Join(t.TempDir(), "authorized_peers")
+		known, _ := identity.Generate()
+		identity.AddPeer(peersFile, identity.Peer{Name: "known", PublicKey: known.PublicKey()})
+
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		errChan := make(chan error, 1)
+		go func() {
+			_, _, err := receivePayload(server, typeMessage, key, Options{AuthorizedPeers: peersFile}, logger)
+			errChan <- err
+		}()
+
+		_, err := sendPayload(client, typeMessage, []byte("hello"), key, Options{}, logger)
+		if !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("Sender got %v, want ErrAuthFailed", err)
+		}
+		if err := <-errChan; !errors.Is(err, ErrAuthFailed) {
+			t.Errorf("Receiver got %v, want ErrAuthFailed", err)
+		}
+	})
+
+	// Both sides fail with the category the receiver refused with
+	refused := func(t *testing.T, senderOpts, receiverOpts Options, want error) {
+		t.Helper()
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		errChan := make(chan error, 1)
+		go func() {
+			_, _, err := receivePayload(server, typeMessage, key, receiverOpts, logger)
+			errChan <- err
+		}()
+
+		_, err := sendPayload(client, typeMessage, []byte("hello"), key, senderOpts, logger)
+		if !errors.Is(err, want) || errors.Is(err, ErrAuthFailed) {
+			t.Errorf("Sender got %v, want only %v", err, want)
+		}
+		if err := <-errChan; !errors.Is(err, want) || errors.Is(err, ErrAuthFailed) {
+			t.Errorf("Receiver got %v, want only %v", err, want)
+		}
+	}
+
+	t.Run("Protocol mismatch", func(t *testing.T) {
+		refused(t, Options{Cipher: crypto.CipherAES256GCM}, Options{Cipher: crypto.CipherXChaCha20Poly1305}, ErrProtocol)
+	})
+
+	t.Run("Replayed", func(t *testing.T) {
+		guard := NewReplayGuard(time.Minute, 10)
+		guard.now = func() time.Time { return time.Now().Add(time.Hour) }
+		refused(t, Options{}, Options{Replay: guard}, ErrReplayed)
+	})
+
+	t.Run("Integrity", func(t *testing.T) {
+		wrongKey, _ := crypto.GenerateKey()
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		go sendPayload(client, typeMessage, []byte("hello"), wrongKey, Options{}, logger)
+
+		_, _, err := receivePayload(server, typeMessage, key, Options{}, logger)
+		if !errors.Is(err, ErrIntegrity) {
+			t.Errorf("Got %v, want ErrIntegrity", err)
+		}
+	})
+}
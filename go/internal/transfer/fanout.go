@@ -0,0 +1,70 @@
+package transfer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Delivery is the outcome of sending to one recipient of a fan-out
+type Delivery struct {
+	Address  string
+	Err      error
+	Duration time.Duration
+}
+
+// FanoutError reports the recipients a fan-out send failed for
+type FanoutError struct {
+	Failed []Delivery
+	Total  int
+}
+
+func (e *FanoutError) Error() string {
+	if len(e.Failed) == 1 && e.Total == 1 {
+		return fmt.Sprintf("%s: %v", e.Failed[0].Address, e.Failed[0].Err)
+	}
+	return fmt.Sprintf("sending failed for %d of %d recipients", len(e.Failed), e.Total)
+}
+
+// Unwrap returns the failures, so errors.Is matches a category any of
+// them belongs to
+func (e *FanoutError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, d := range e.Failed {
+		errs[i] = d.Err
+	}
+	return errs
+}
+
+// Fanout calls send for every address, at most parallel at a time, and
+// returns the deliveries in the order of addresses. The error is a
+// *FanoutError when any send failed.
+func Fanout(addresses []string, parallel int, send func(address string) error) ([]Delivery, error) {
+	parallel = max(parallel, 1)
+	deliveries := make([]Delivery, len(addresses))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			start := time.Now()
+			err := send(address)
+			deliveries[i] = Delivery{Address: address, Err: err, Duration: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+
+	var failed []Delivery
+	for _, d := range deliveries {
+		if d.Err != nil {
+			failed = append(failed, d)
+		}
+	}
+	if len(failed) > 0 {
+		return deliveries, &FanoutError{Failed: failed, Total: len(addresses)}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,65 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanoutBoundsParallelism(t *testing.T) {
+	var running, peak atomic.Int32
+	addresses := []string{"a:1", "b:1", "c:1", "d:1", "e:1"}
+	deliveries, err := Fanout(addresses, 2, func(address string) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Fanout failed: %v", err)
+	}
+	if got := peak.Load(); got != 2 {
+		t.Errorf("Peak parallelism = %d, want 2", got)
+	}
+	for i, d := range deliveries {
+		if d.Address != addresses[i] || d.Err != nil {
+			t.Errorf("Delivery %d = %+v", i, d)
+		}
+	}
+}
+
+func TestFanoutReportsFailures(t *testing.T) {
+	deliveries, err := Fanout([]string{"up:1", "down:1", "denied:1"}, 0, func(address string) error {
+		switch address {
+		case "down:1":
+			return fmt.Errorf("%w: connection refused", ErrPeerUnreachable)
+		case "denied:1":
+			return ErrAuthFailed
+		}
+		return nil
+	})
+	var fanout *FanoutError
+	if !errors.As(err, &fanout) {
+		t.Fatalf("Fanout returned %v, want a FanoutError", err)
+	}
+	if fanout.Total != 3 || len(fanout.Failed) != 2 || fanout.Failed[0].Address != "down:1" {
+		t.Errorf("FanoutError = %+v", fanout)
+	}
+	if err.Error() != "sending failed for 2 of 3 recipients" {
+		t.Errorf("Error() = %q", err)
+	}
+	if !errors.Is(err, ErrPeerUnreachable) || !errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrIntegrity) {
+		t.Error("FanoutError does not unwrap to exactly the failures' categories")
+	}
+	if len(deliveries) != 3 || deliveries[0].Err != nil {
+		t.Errorf("Deliveries = %+v", deliveries)
+	}
+}
@@ -0,0 +1,58 @@
+package transfer
+
+import (
+	"sync"
+	"time"
+)
+
+// Received describes one item taken in by a receiver
+type Received struct {
+	Time        time.Time `json:"time"`
+	Remote      string    `json:"remote"`
+	Peer        string    `json:"peer,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	Type        string    `json:"type"`
+	Size        int       `json:"size"`
+	Content     string    `json:"content"`
+}
+
+// History keeps the most recent received items in memory
+type History struct {
+	capacity int
+
+	mu    sync.Mutex
+	items []Received
+}
+
+// NewHistory creates a history holding up to capacity items
+func NewHistory(capacity int) *History {
+	return &History{capacity: capacity}
+}
+
+// add records an item, dropping the oldest when full
+func (h *History) add(item Received) {
+	if h == nil || h.capacity <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.items) >= h.capacity {
+		h.items = append(h.items[:0], h.items[1:]...)
+	}
+	h.items = append(h.items, item)
+}
+
+// Recent returns up to limit items, newest first; all of them when limit
+// is zero
+func (h *History) Recent(limit int) []Received {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if limit <= 0 || limit > len(h.items) {
+		limit = len(h.items)
+	}
+	recent := make([]Received, 0, limit)
+	for i := len(h.items) - 1; len(recent) < limit; i-- {
+		recent = append(recent, h.items[i])
+	}
+	return recent
+}
@@ -0,0 +1,21 @@
+package transfer
+
+import "testing"
+
+func TestHistoryKeepsNewest(t *testing.T) {
+	h := NewHistory(3)
+	for _, content := range []string{"a", "b", "c", "d"} {
+		h.add(Received{Content: content})
+	}
+
+	recent := h.Recent(0)
+	if len(recent) != 3 || recent[0].Content != "d" || recent[2].Content != "b" {
+		t.Errorf("Recent(0) = %+v, want d, c, b", recent)
+	}
+	if recent := h.Recent(1); len(recent) != 1 || recent[0].Content != "d" {
+		t.Errorf("Recent(1) = %+v", recent)
+	}
+
+	var disabled *History
+	disabled.add(Received{Content: "ignored"})
+}
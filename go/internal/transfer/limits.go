@@ -0,0 +1,189 @@
+package transfer
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Limits protect a listener from misbehaving or abusive senders. Zero
+// values disable the corresponding limit.
+type Limits struct {
+	// MaxConnections caps the connections handled concurrently
+	MaxConnections int
+
+	// RatePerIP is the sustained number of connections per second accepted
+	// from one IP address, with bursts of up to Burst
+	RatePerIP float64
+	Burst     int
+
+	// ReadTimeout bounds the time from accept until the payload is read
+	ReadTimeout time.Duration
+
+	// WriteTimeout bounds each write to the peer
+	WriteTimeout time.Duration
+
+	// IdleTimeout closes connections that send nothing for this long
+	IdleTimeout time.Duration
+
+	// MaxPayload is the largest payload accepted, checked against the frame
+	// size before anything is buffered and again after decompression
+	MaxPayload int
+}
+
+// maxPayload returns the payload cap, 0 when payloads are unlimited
+func (l Limits) maxPayload() int {
+	return max(l.MaxPayload, 0)
+}
+
+// deadlineConn applies Limits deadlines to every read and write
+type deadlineConn struct {
+	net.Conn
+	limits Limits
+	readBy time.Time
+}
+
+// withDeadlines wraps conn so every operation is bounded by limits
+func withDeadlines(conn net.Conn, limits Limits) net.Conn {
+	if limits.ReadTimeout == 0 && limits.WriteTimeout == 0 && limits.IdleTimeout == 0 {
+		return conn
+	}
+	dc := &deadlineConn{Conn: conn, limits: limits}
+	if limits.ReadTimeout > 0 {
+		dc.readBy = time.Now().Add(limits.ReadTimeout)
+	}
+	return dc
+}
+
+// Read reads with a deadline of the idle timeout, capped by the read timeout
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	deadline := c.readBy
+	if c.limits.IdleTimeout > 0 {
+		idle := time.Now().Add(c.limits.IdleTimeout)
+		if deadline.IsZero() || idle.Before(deadline) {
+			deadline = idle
+		}
+	}
+	if err := c.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+// Write writes with the write timeout as deadline
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	var deadline time.Time
+	if c.limits.WriteTimeout > 0 {
+		deadline = time.Now().Add(c.limits.WriteTimeout)
+	}
+	if err := c.Conn.SetWriteDeadline(deadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(p)
+}
+
+// connLimiter enforces the connection cap and per-IP rates at accept time
+type connLimiter struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	limits  Limits
+	active  int
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket holds the connection allowance of one IP address
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxBuckets bounds the per-IP state; full buckets are dropped beyond it
+const maxBuckets = 4096
+
+func newConnLimiter(limits Limits) *connLimiter {
+	return &connLimiter{
+		limits:  limits,
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// update applies reloaded limits. Connections already open keep their
+// slots; a lower cap only refuses new ones until enough have closed.
+func (l *connLimiter) update(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+// allowIP takes a token from the bucket of ip, reporting whether one was left
+func (l *connLimiter) allowIP(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limits.RatePerIP <= 0 {
+		return true
+	}
+	burst := float64(l.limits.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	now := l.now()
+	bucket, ok := l.buckets[ip]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.pruneLocked(now, burst)
+		}
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets[ip] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.limits.RatePerIP
+	if bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// pruneLocked forgets addresses whose bucket has refilled completely
+func (l *connLimiter) pruneLocked(now time.Time, burst float64) {
+	for ip, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.limits.RatePerIP >= burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// acquire reserves a connection slot without blocking
+func (l *connLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.MaxConnections > 0 && l.active >= l.limits.MaxConnections {
+		return false
+	}
+	l.active++
+	return true
+}
+
+// release frees a slot taken by acquire
+func (l *connLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+}
+
+// remoteIP returns the IP part of a connection's remote address
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
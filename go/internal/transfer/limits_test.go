@@ -0,0 +1,150 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConnLimiterRate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newConnLimiter(Limits{RatePerIP: 1, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.allowIP("10.0.0.1") || !limiter.allowIP("10.0.0.1") {
+		t.Fatal("Burst connections should be allowed")
+	}
+	if limiter.allowIP("10.0.0.1") {
+		t.Error("Connection beyond the burst should be refused")
+	}
+	if !limiter.allowIP("10.0.0.2") {
+		t.Error("Other addresses should have their own allowance")
+	}
+
+	now = now.Add(time.Second)
+	if !limiter.allowIP("10.0.0.1") {
+		t.Error("Allowance should refill over time")
+	}
+	if limiter.allowIP("10.0.0.1") {
+		t.Error("Refill should not exceed the rate")
+	}
+}
+
+func TestConnLimiterSlots(t *testing.T) {
+	limiter := newConnLimiter(Limits{MaxConnections: 2})
+
+	if !limiter.acquire() || !limiter.acquire() {
+		t.Fatal("Connections below the cap should be allowed")
+	}
+	if limiter.acquire() {
+		t.Error("Connection above the cap should be refused")
+	}
+	limiter.release()
+	if !limiter.acquire() {
+		t.Error("Released slot should be reusable")
+	}
+}
+
+func TestConnLimiterUpdate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newConnLimiter(Limits{MaxConnections: 2})
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.acquire() || !limiter.acquire() {
+		t.Fatal("Connections below the cap should be allowed")
+	}
+	limiter.update(Limits{MaxConnections: 1, RatePerIP: 1, Burst: 1})
+	limiter.release()
+	if limiter.acquire() {
+		t.Error("Connection above the lowered cap should be refused")
+	}
+	limiter.release()
+	if !limiter.acquire() {
+		t.Error("Connection below the lowered cap should be allowed")
+	}
+	if !limiter.allowIP("10.0.0.1") || limiter.allowIP("10.0.0.1") {
+		t.Error("Rate added by the update should apply")
+	}
+
+	limiter.update(Limits{})
+	if !limiter.acquire() || !limiter.allowIP("10.0.0.1") {
+		t.Error("Removed limits should no longer apply")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	conn := withDeadlines(server, Limits{IdleTimeout: 50 * time.Millisecond})
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Idle connection was held for %s", elapsed)
+	}
+}
+
+func TestReadTimeoutCapsSlowSenders(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Each byte arrives within the idle timeout, but the whole read takes too long
+	go func() {
+		for i := 0; i < 20; i++ {
+			if _, err := client.Write([]byte{'0'}); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	conn := withDeadlines(server, Limits{ReadTimeout: 100 * time.Millisecond, IdleTimeout: 50 * time.Millisecond})
+	_, err := io.ReadFull(conn, make([]byte, 20))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Got %v, want deadline exceeded", err)
+	}
+}
+
+func TestOversizedFrameRejectedBeforeBuffering(t *testing.T) {
+	// Announce a huge frame but send no body: the size alone must be refused
+	_, err := readFrame(bytes.NewReader(binary.BigEndian.AppendUint64(nil, 50000000)), 1024)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestTruncatedFrameNotPreallocated(t *testing.T) {
+	// A frame announcing far more than it sends fails without the announced
+	// size ever being allocated
+	header := binary.BigEndian.AppendUint64(nil, 1<<40)
+	_, err := readFrame(io.MultiReader(bytes.NewReader(header), bytes.NewReader([]byte("short"))), 0)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Got %v, want unexpected EOF", err)
+	}
+}
+
+func TestSenderHonoursReceiverLimit(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go receivePayload(server, typeMessage, key, Options{Limits: Limits{MaxPayload: 1024}}, logger)
+
+	payload := make([]byte, 4096)
+	_, err := sendPayload(client, typeMessage, payload, key, Options{Compression: "none"}, logger)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Got %v, want ErrTooLarge", err)
+	}
+}
@@ -0,0 +1,70 @@
+package transfer
+
+import (
+	"errors"
+	"time"
+
+	"secure-transfer/internal/metrics"
+)
+
+// Reasons a connection is rejected, used as metric labels
+const (
+	rejectACL       = "acl"
+	rejectRate      = "rate"
+	rejectCapacity  = "capacity"
+	rejectReplay    = "replay"
+	rejectHandshake = "handshake"
+)
+
+// Metrics instruments transfers. The zero value records nothing.
+type Metrics struct {
+	ConnectionsAccepted *metrics.Counter
+	ConnectionsRejected *metrics.CounterVec
+	ActiveConnections   *metrics.Gauge
+	BytesReceived       *metrics.Counter
+	BytesSent           *metrics.Counter
+	DecryptionFailures  *metrics.Counter
+	ClipboardFailures   *metrics.Counter
+	TransferDuration    *metrics.HistogramVec
+}
+
+// NewMetrics registers the transfer metrics in reg
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		ConnectionsAccepted: reg.Counter("secure_transfer_connections_accepted_total", "Connections accepted by receivers"),
+		ConnectionsRejected: reg.CounterVec("secure_transfer_connections_rejected_total", "Connections refused by receivers", "reason"),
+		ActiveConnections:   reg.Gauge("secure_transfer_active_connections", "Connections currently being handled"),
+		BytesReceived:       reg.Counter("secure_transfer_received_bytes_total", "Payload bytes received after decryption and decompression"),
+		BytesSent:           reg.Counter("secure_transfer_sent_bytes_total", "Payload bytes sent before compression and encryption"),
+		DecryptionFailures:  reg.Counter("secure_transfer_decryption_failures_total", "Payloads that failed to decrypt or authenticate"),
+		ClipboardFailures:   reg.Counter("secure_transfer_clipboard_failures_total", "Received content that could not be copied to the clipboard"),
+		TransferDuration:    reg.HistogramVec("secure_transfer_duration_seconds", "Time from connection to completed transfer", "direction", metrics.DefaultBuckets),
+	}
+}
+
+// metrics returns the configured metrics or a no-op set
+func (o Options) metrics() *Metrics {
+	if o.Metrics == nil {
+		return &Metrics{}
+	}
+	return o.Metrics
+}
+
+// rejected counts a connection refused for reason
+func (m *Metrics) rejected(reason string) {
+	m.ConnectionsRejected.With(reason).Inc()
+}
+
+// handshakeFailed counts a connection whose handshake was refused
+func (m *Metrics) handshakeFailed(err error) {
+	if errors.Is(err, errReplayed) || errors.Is(err, errStale) {
+		m.rejected(rejectReplay)
+		return
+	}
+	m.rejected(rejectHandshake)
+}
+
+// observe records the duration of a completed transfer
+func (m *Metrics) observe(direction string, start time.Time) {
+	m.TransferDuration.With(direction).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,80 @@
+package transfer
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/metrics"
+)
+
+func TestMetricsCountTransfers(t *testing.T) {
+	logger := testLogger(t)
+	_, key := setupTestServerClient(t)
+	m := NewMetrics(metrics.NewRegistry())
+	opts := Options{Metrics: m, Clipboard: ClipboardNever}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	serve := func() chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			handleEchoConnection(conn, key, opts, logger)
+		}()
+		return done
+	}
+
+	done := serve()
+	if err := SendMessage("127.0.0.1", port, "", "hello", key, opts, logger); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	<-done
+
+	wrongKey, _ := crypto.GenerateKey()
+	done = serve()
+	if err := SendMessage("127.0.0.1", port, "", "hello", wrongKey, Options{}, logger); err == nil {
+		t.Error("Message with the wrong key should fail")
+	}
+	<-done
+
+	if got := m.BytesReceived.Value(); got != 5 {
+		t.Errorf("Bytes received = %d, want 5", got)
+	}
+	if got := m.BytesSent.Value(); got != 5 {
+		t.Errorf("Bytes sent = %d, want 5", got)
+	}
+	if got := m.DecryptionFailures.Value(); got != 1 {
+		t.Errorf("Decryption failures = %d, want 1", got)
+	}
+	if got := m.TransferDuration.With("receive").Count(); got != 1 {
+		t.Errorf("Receive durations observed = %d, want 1", got)
+	}
+	if got := m.TransferDuration.With("send").Count(); got != 1 {
+		t.Errorf("Send durations observed = %d, want 1", got)
+	}
+}
+
+func TestMetricsCountReplays(t *testing.T) {
+	m := NewMetrics(metrics.NewRegistry())
+	m.handshakeFailed(errReplayed)
+	m.handshakeFailed(errStale)
+	m.handshakeFailed(io.ErrUnexpectedEOF)
+
+	if got := m.ConnectionsRejected.With(rejectReplay).Value(); got != 2 {
+		t.Errorf("Replay rejections = %d, want 2", got)
+	}
+	if got := m.ConnectionsRejected.With(rejectHandshake).Value(); got != 1 {
+		t.Errorf("Handshake rejections = %d, want 1", got)
+	}
+}
@@ -0,0 +1,485 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"secure-transfer/internal/compress"
+	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/identity"
+)
+
+// protocolVersion is bumped whenever the handshake changes incompatibly
+const protocolVersion = 5
+
+// Transfer types carried in the client hello
+const (
+	typeFile    = "file"
+	typeMessage = "message"
+)
+
+// Frame types bound into the additional data of every encrypted frame, so a
+// response can never be accepted as a payload or the other way round
+const (
+	frameTypeData     byte = 1
+	frameTypeResponse byte = 2
+)
+
+// frameHeaderSize is the length of the big-endian uint64 size prefix on
+// every frame
+const frameHeaderSize = 8
+
+// maxFrameSize is the largest frame that can be buffered
+const maxFrameSize = math.MaxInt
+
+// frameReadChunk is how much of a frame's body is allocated ahead of
+// the data arriving, so an announced size alone can't exhaust memory
+const frameReadChunk = 1024 * 1024
+
+// maxHandshakeFrame caps handshake messages and responses, which are small
+const maxHandshakeFrame = 64 * 1024
+
+// nonceSize is the length of the handshake challenges
+const nonceSize = 32
+
+// deriveKey is crypto.DeriveKey, replaced in tests to observe derivations
+var deriveKey = crypto.DeriveKey
+
+// maxDerivations bounds the passphrase derivations a receiver runs at
+// once, each of which may take up to the largest memory cost accepted
+const maxDerivations = 2
+
+// derivationSlots holds a slot for each derivation in progress
+var derivationSlots = make(chan struct{}, maxDerivations)
+
+// clientHello opens every connection and proposes transfer parameters
+type clientHello struct {
+	Version     int        `json:"version"`
+	Type        string     `json:"type"`
+	Compression []string   `json:"compression"`
+	Identity    string     `json:"identity"`
+	Nonce       []byte     `json:"nonce"`
+	Timestamp   time.Time  `json:"timestamp"`
+	KDF         *kdfHeader `json:"kdf,omitempty"`
+	Ciphers     []string   `json:"ciphers,omitempty"`
+}
+
+// kdfHeader carries the salt and cost used to derive the key from a
+// passphrase, so both sides arrive at the same key
+type kdfHeader struct {
+	Salt   []byte           `json:"salt"`
+	Params crypto.KDFParams `json:"params"`
+}
+
+// serverHello answers a clientHello with the parameters chosen by the receiver
+type serverHello struct {
+	Version     int    `json:"version"`
+	Compression string `json:"compression,omitempty"`
+	Cipher      string `json:"cipher,omitempty"`
+	MaxPayload  int    `json:"max_payload,omitempty"`
+	Identity    string `json:"identity,omitempty"`
+	Nonce       []byte `json:"nonce,omitempty"`
+	Signature   []byte `json:"signature,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	// Refusal is the failure category of Error, a key of refusals
+	Refusal string `json:"refusal,omitempty"`
+}
+
+// clientAuth proves the client holds the key it announced
+type clientAuth struct {
+	Signature []byte `json:"signature"`
+}
+
+// handshakeResult tells the client whether it was authenticated
+type handshakeResult struct {
+	Error string `json:"error,omitempty"`
+}
+
+// session holds the parameters agreed during the handshake
+type session struct {
+	compression string
+	cipher      crypto.Cipher
+	peer        identity.Peer
+	maxPayload  int
+
+	// receiverTrust is how the sender knows the receiver's identity
+	receiverTrust receiverTrust
+
+	// key encrypts the payload; derived from the passphrase during the
+	// handshake, or the shared key that decrypted it
+	key []byte
+
+	// id is derived from both handshake nonces and is unique per connection
+	id []byte
+
+	// sendSeq and recvSeq number the encrypted frames in each direction
+	sendSeq uint64
+	recvSeq uint64
+}
+
+// newSessionID derives the session ID from both sides' nonces
+func newSessionID(clientNonce, serverNonce []byte) []byte {
+	sum := sha256.Sum256(signedData("session", clientNonce, serverNonce))
+	return sum[:16]
+}
+
+// logID returns the session ID as logged by both sides
+func (s session) logID() string {
+	return hex.EncodeToString(s.id)
+}
+
+// frameAAD binds a frame to the protocol version, its type, the session
+// and its position, so frames cannot be replayed, reordered or swapped
+func (s *session) frameAAD(frameType byte, seq uint64) []byte {
+	aad := make([]byte, 0, 2+len(s.id)+8)
+	aad = append(aad, protocolVersion, frameType)
+	aad = append(aad, s.id...)
+	return binary.BigEndian.AppendUint64(aad, seq)
+}
+
+// suite returns the negotiated cipher, AES-256-GCM if none was negotiated
+func (s *session) suite() crypto.Cipher {
+	if s.cipher == nil {
+		return crypto.AES256GCM{}
+	}
+	return s.cipher
+}
+
+// seal encrypts the next outgoing frame
+func (s *session) seal(frameType byte, data []byte) ([]byte, error) {
+	sealed, err := s.suite().Seal(data, s.key, s.frameAAD(frameType, s.sendSeq))
+	if err != nil {
+		return nil, err
+	}
+	s.sendSeq++
+	return sealed, nil
+}
+
+// open decrypts the next incoming frame, which must be of frameType
+func (s *session) open(frameType byte, data []byte) ([]byte, error) {
+	opened, err := s.suite().Open(data, s.key, s.frameAAD(frameType, s.recvSeq))
+	if err != nil {
+		return nil, err
+	}
+	s.recvSeq++
+	return opened, nil
+}
+
+// writeFrame writes data prefixed with its size
+func writeFrame(w io.Writer, data []byte) error {
+	header := binary.BigEndian.AppendUint64(make([]byte, 0, frameHeaderSize), uint64(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads a single size-prefixed frame of at most maxSize bytes,
+// or any size a buffer can hold when maxSize is 0. The size is checked
+// before the frame is buffered, and the buffer grows only as the body
+// arrives.
+func readFrame(r io.Reader, maxSize int) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint64(header)
+	limit := maxFrameSize
+	if maxSize > 0 {
+		limit = maxSize
+	}
+	if size > uint64(limit) {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, size, limit)
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, min(size, frameReadChunk)))
+	if _, err := io.CopyN(buf, r, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSON writes v as a single JSON frame
+func writeJSON(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, data)
+}
+
+// readJSON reads a single JSON frame into v
+func readJSON(r io.Reader, v any) error {
+	data, err := readFrame(r, maxHandshakeFrame)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// clientHandshake proposes parameters, authenticates both sides and
+// returns the agreed session
+func clientHandshake(rw io.ReadWriter, transferType string, offers []string, opts Options) (session, error) {
+	self, err := opts.identity()
+	if err != nil {
+		return session{}, err
+	}
+
+	hello := clientHello{
+		Version:     protocolVersion,
+		Type:        transferType,
+		Compression: offers,
+		Identity:    identity.FormatPublicKey(self.PublicKey()),
+		Nonce:       make([]byte, nonceSize),
+		Timestamp:   time.Now(),
+		Ciphers:     opts.ciphers(),
+	}
+	if _, err := rand.Read(hello.Nonce); err != nil {
+		return session{}, err
+	}
+	var sessionKey []byte
+	if opts.Passphrase != "" {
+		salt, err := crypto.NewSalt()
+		if err != nil {
+			return session{}, err
+		}
+		hello.KDF = &kdfHeader{Salt: salt, Params: opts.kdfParams()}
+		if sessionKey, err = crypto.DeriveKey(opts.Passphrase, salt, hello.KDF.Params); err != nil {
+			return session{}, fmt.Errorf("key derivation error: %w", err)
+		}
+	}
+	helloData, err := json.Marshal(hello)
+	if err != nil {
+		return session{}, err
+	}
+	if err := writeFrame(rw, helloData); err != nil {
+		return session{}, fmt.Errorf("error sending handshake: %w", err)
+	}
+
+	replyData, err := readFrame(rw, maxHandshakeFrame)
+	if err != nil {
+		return session{}, fmt.Errorf("error reading handshake: %w", err)
+	}
+	var reply serverHello
+	if err := json.Unmarshal(replyData, &reply); err != nil {
+		return session{}, fmt.Errorf("error reading handshake: %w", err)
+	}
+	if reply.Error != "" {
+		return session{}, fmt.Errorf("%w: receiver rejected transfer: %s", refusalClass(reply.Refusal), reply.Error)
+	}
+	if reply.Version != protocolVersion {
+		return session{}, fmt.Errorf("%w: unsupported protocol version %d", ErrProtocol, reply.Version)
+	}
+	suite, err := crypto.SelectCipher([]string{reply.Cipher}, hello.Ciphers)
+	if err != nil {
+		return session{}, fmt.Errorf("%w: receiver chose a cipher we did not offer: %w", ErrProtocol, err)
+	}
+
+	// The receiver signs our hello together with its own unsigned hello
+	serverKey, err := identity.ParsePublicKey(reply.Identity)
+	if err != nil {
+		return session{}, fmt.Errorf("%w: invalid receiver identity: %w", ErrAuthFailed, err)
+	}
+	signature := reply.Signature
+	reply.Signature = nil
+	unsigned, err := json.Marshal(reply)
+	if err != nil {
+		return session{}, err
+	}
+	if !ed25519.Verify(serverKey, signedData("server", helloData, unsigned), signature) {
+		return session{}, fmt.Errorf("%w: receiver failed to prove identity %s", ErrAuthFailed, identity.Fingerprint(serverKey))
+	}
+	trust, err := opts.verifyReceiver(serverKey)
+	if err != nil {
+		return session{}, err
+	}
+	// The authorized peers list says who may send here, not where we may send
+	peer := identity.Peer{PublicKey: serverKey}
+
+	auth := clientAuth{Signature: self.Sign(signedData("client", helloData, replyData))}
+	if err := writeJSON(rw, auth); err != nil {
+		return session{}, fmt.Errorf("error sending authentication: %w", err)
+	}
+	var result handshakeResult
+	if err := readJSON(rw, &result); err != nil {
+		return session{}, fmt.Errorf("error reading authentication result: %w", err)
+	}
+	if result.Error != "" {
+		return session{}, fmt.Errorf("%w: receiver rejected transfer: %s", ErrAuthFailed, result.Error)
+	}
+
+	return session{
+		compression: reply.Compression,
+		cipher:      suite,
+		maxPayload:  reply.MaxPayload,
+		peer:        peer,
+		key:         sessionKey,
+		id:          newSessionID(hello.Nonce, reply.Nonce),
+
+		receiverTrust: trust,
+	}, nil
+}
+
+// serverHandshake reads the client hello, checks it against the expected
+// transfer type, authenticates both sides and answers with the chosen
+// parameters
+func serverHandshake(rw io.ReadWriter, transferType string, opts Options) (session, error) {
+	self, err := opts.identity()
+	if err != nil {
+		return session{}, err
+	}
+
+	helloData, err := readFrame(rw, maxHandshakeFrame)
+	if err != nil {
+		return session{}, fmt.Errorf("error reading handshake: %w", err)
+	}
+	var hello clientHello
+	if err := json.Unmarshal(helloData, &hello); err != nil {
+		return session{}, fmt.Errorf("error reading handshake: %w", err)
+	}
+
+	// reject refuses the handshake, telling the sender why and in which
+	// failure category
+	reject := func(class error, reason string) (session, error) {
+		writeJSON(rw, serverHello{Version: protocolVersion, Error: reason, Refusal: refusalName(class)})
+		return session{}, fmt.Errorf("%w: handshake rejected: %s", class, reason)
+	}
+
+	if hello.Version != protocolVersion {
+		return reject(ErrProtocol, fmt.Sprintf("unsupported protocol version %d", hello.Version))
+	}
+	if hello.Type != transferType {
+		return reject(ErrProtocol, fmt.Sprintf("expected a %s transfer, got %q", transferType, hello.Type))
+	}
+	if len(hello.Nonce) != nonceSize {
+		return reject(ErrProtocol, "invalid handshake nonce")
+	}
+	// Checked before the sender is authenticated: a replayed stream fails
+	// the signature over our fresh nonce, which would hide that it is a
+	// replay. The cache is bounded, so forged hellos cannot grow it.
+	if opts.Replay != nil {
+		if err := opts.Replay.Check(hello.Nonce, hello.Timestamp); err != nil {
+			writeJSON(rw, serverHello{Version: protocolVersion, Error: "message rejected as a replay", Refusal: refusalName(ErrReplayed)})
+			return session{}, fmt.Errorf("%w: handshake rejected: %w", ErrReplayed, err)
+		}
+	}
+	algo, err := compress.Select(hello.Compression)
+	if err != nil {
+		return reject(ErrProtocol, err.Error())
+	}
+	suite, err := crypto.SelectCipher(hello.Ciphers, opts.ciphers())
+	if err != nil {
+		return reject(ErrProtocol, err.Error())
+	}
+	clientKey, err := identity.ParsePublicKey(hello.Identity)
+	if err != nil {
+		return reject(ErrProtocol, "invalid sender identity")
+	}
+	peer, err := opts.authorizePeer(clientKey)
+	if errors.Is(err, ErrAuthFailed) {
+		return reject(ErrAuthFailed, fmt.Sprintf("peer %s is not authorized", identity.Fingerprint(clientKey)))
+	}
+	if err != nil {
+		return reject(ErrAuthFailed, err.Error())
+	}
+	switch {
+	case hello.KDF == nil && opts.Passphrase != "":
+		return reject(ErrProtocol, "receiver requires a passphrase")
+	case hello.KDF != nil && opts.Passphrase == "":
+		return reject(ErrProtocol, "receiver has no passphrase configured")
+	case hello.KDF != nil:
+		if len(hello.KDF.Salt) != crypto.SaltSize {
+			return reject(ErrProtocol, "invalid key derivation salt")
+		}
+		if err := hello.KDF.Params.Validate(); err != nil {
+			return reject(ErrProtocol, err.Error())
+		}
+		if err := hello.KDF.Params.AtLeast(opts.kdfParams()); err != nil {
+			return reject(ErrProtocol, err.Error())
+		}
+	}
+
+	reply := serverHello{
+		Version:     protocolVersion,
+		Compression: algo,
+		Cipher:      suite.Name(),
+		MaxPayload:  opts.Limits.maxPayload(),
+		Identity:    identity.FormatPublicKey(self.PublicKey()),
+		Nonce:       make([]byte, nonceSize),
+	}
+	if _, err := rand.Read(reply.Nonce); err != nil {
+		return session{}, err
+	}
+	unsigned, err := json.Marshal(reply)
+	if err != nil {
+		return session{}, err
+	}
+	reply.Signature = self.Sign(signedData("server", helloData, unsigned))
+	replyData, err := json.Marshal(reply)
+	if err != nil {
+		return session{}, err
+	}
+	if err := writeFrame(rw, replyData); err != nil {
+		return session{}, fmt.Errorf("error sending handshake: %w", err)
+	}
+
+	var auth clientAuth
+	if err := readJSON(rw, &auth); err != nil {
+		return session{}, fmt.Errorf("error reading authentication: %w", err)
+	}
+	if !ed25519.Verify(clientKey, signedData("client", helloData, replyData), auth.Signature) {
+		writeJSON(rw, handshakeResult{Error: "authentication failed"})
+		return session{}, fmt.Errorf("%w: sender failed to prove identity %s", ErrAuthFailed, peer.Fingerprint())
+	}
+	// The derivation is costly by design. Any sender can sign with a
+	// fresh key unless authorized peers are enforced, so a checked
+	// signature alone doesn't bound the cost; derivations also wait for
+	// one of a few slots shared by all connections.
+	var sessionKey []byte
+	if hello.KDF != nil {
+		derivationSlots <- struct{}{}
+		sessionKey, err = deriveKey(opts.Passphrase, hello.KDF.Salt, hello.KDF.Params)
+		<-derivationSlots
+		if err != nil {
+			writeJSON(rw, handshakeResult{Error: "key derivation failed"})
+			return session{}, fmt.Errorf("key derivation error: %w", err)
+		}
+	}
+	if err := writeJSON(rw, handshakeResult{}); err != nil {
+		return session{}, fmt.Errorf("error sending authentication result: %w", err)
+	}
+
+	return session{
+		compression: algo,
+		cipher:      suite,
+		maxPayload:  opts.Limits.maxPayload(),
+		peer:        peer,
+		key:         sessionKey,
+		id:          newSessionID(hello.Nonce, reply.Nonce),
+	}, nil
+}
+
+// signedData builds the handshake transcript a side signs
+func signedData(role string, parts ...[]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("secure-transfer handshake " + role)
+	for _, part := range parts {
+		buf.WriteByte(0)
+		buf.Write(part)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,159 @@
+package transfer
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"secure-transfer/internal/crypto"
+)
+
+// recordingConn keeps a copy of every write; writeFrame writes the size
+// prefix and the payload separately
+type recordingConn struct {
+	net.Conn
+	writes [][]byte
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.writes = append(c.writes, append([]byte(nil), p...))
+	return c.Conn.Write(p)
+}
+
+func TestSessionFramesAreBound(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	sender := session{key: key, id: newSessionID([]byte("client"), []byte("server"))}
+	receiver := sender
+	other := session{key: key, id: newSessionID([]byte("client"), []byte("other"))}
+
+	first, err := sender.seal(frameTypeData, []byte("first"))
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	second, err := sender.seal(frameTypeData, []byte("second"))
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+
+	if _, err := other.open(frameTypeData, first); err == nil {
+		t.Error("Frame from another session was accepted")
+	}
+	if _, err := receiver.open(frameTypeData, second); err == nil {
+		t.Error("Reordered frame was accepted")
+	}
+	if _, err := receiver.open(frameTypeResponse, first); err == nil {
+		t.Error("Data frame was accepted as a response")
+	}
+
+	if data, err := receiver.open(frameTypeData, first); err != nil || string(data) != "first" {
+		t.Fatalf("Failed to open first frame: %q, %v", data, err)
+	}
+	if _, err := receiver.open(frameTypeData, first); err == nil {
+		t.Error("Replayed frame was accepted")
+	}
+	if data, err := receiver.open(frameTypeData, second); err != nil || string(data) != "second" {
+		t.Fatalf("Failed to open second frame: %q, %v", data, err)
+	}
+}
+
+func TestReplayedFrameRejected(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+
+	// Capture the encrypted payload frame of a genuine transfer
+	client, server := net.Pipe()
+	recorder := &recordingConn{Conn: client}
+	go sendPayload(recorder, typeMessage, []byte("overwrite the clipboard"), key, Options{}, logger)
+	if _, _, err := receivePayload(server, typeMessage, key, Options{}, logger); err != nil {
+		t.Fatalf("Failed to receive original transfer: %v", err)
+	}
+	client.Close()
+	server.Close()
+	captured := recorder.writes[len(recorder.writes)-1]
+
+	// Replay it after a fresh handshake
+	client, server = net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		if _, err := clientHandshake(client, typeMessage, []string{"none"}, Options{}); err == nil {
+			writeFrame(client, captured)
+		}
+	}()
+
+	if _, _, err := receivePayload(server, typeMessage, key, Options{}, logger); err == nil {
+		t.Fatal("Replayed frame was accepted in a new session")
+	}
+}
+
+func TestFrameLargerThanDecimalPrefix(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping 100 MB frame in short mode")
+	}
+	// Frames once carried an 8-digit decimal size, capping them below 100 MB
+	data := make([]byte, 100_000_000)
+	data[len(data)-1] = 1
+	var buf bytes.Buffer
+	if err := writeFrame(&buf, data); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	got, err := readFrame(&buf, 0)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Frame did not round-trip: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestSessionIDsDiffer(t *testing.T) {
+	a := newSessionID([]byte("client nonce"), []byte("server nonce"))
+	b := newSessionID([]byte("server nonce"), []byte("client nonce"))
+	if bytes.Equal(a, b) {
+		t.Error("Session ID should depend on which side contributed each nonce")
+	}
+}
+
+func TestCipherNegotiation(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+
+	testCases := []struct {
+		name     string
+		sender   string
+		receiver string
+		want     string
+	}{
+		{"Default", "", "", crypto.CipherAES256GCM},
+		{"Sender picks XChaCha20", crypto.CipherXChaCha20Poly1305, "", crypto.CipherXChaCha20Poly1305},
+		{"Receiver requires XChaCha20", "", crypto.CipherXChaCha20Poly1305, crypto.CipherXChaCha20Poly1305},
+		{"No common cipher", crypto.CipherAES256GCM, crypto.CipherXChaCha20Poly1305, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			go func() {
+				sendPayload(client, typeFile, []byte("negotiated"), key, Options{Cipher: tc.sender}, logger)
+				client.Close()
+			}()
+
+			data, sess, err := receivePayload(server, typeFile, key, Options{Cipher: tc.receiver}, logger)
+			if tc.want == "" {
+				if err == nil {
+					t.Fatal("Expected negotiation to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to receive: %v", err)
+			}
+			if string(data) != "negotiated" {
+				t.Errorf("Received %q", data)
+			}
+			if got := sess.suite().Name(); got != tc.want {
+				t.Errorf("Negotiated %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
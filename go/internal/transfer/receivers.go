@@ -0,0 +1,60 @@
+package transfer
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sync"
+
+	"secure-transfer/internal/identity"
+)
+
+// receiverTrust says how a sender knows who the receiver is
+type receiverTrust int
+
+const (
+	// trustNone means there was nothing to check the identity against
+	trustNone receiverTrust = iota
+
+	// trustFirstUse means the identity was pinned on this first contact
+	trustFirstUse
+
+	// trustPinned means the identity matched an expected fingerprint
+	trustPinned
+)
+
+// knownReceiversMu serializes pinning, as fan-out sends run concurrently
+var knownReceiversMu sync.Mutex
+
+// verifyReceiver checks the identity a receiver proved against
+// ReceiverFingerprint or, without one, the known receivers file, pinning
+// it on first use
+func (o Options) verifyReceiver(publicKey ed25519.PublicKey) (receiverTrust, error) {
+	fp := identity.Fingerprint(publicKey)
+	if o.ReceiverFingerprint != "" {
+		if fp != o.ReceiverFingerprint {
+			return trustNone, fmt.Errorf("%w: receiver identity %s is not the expected %s", ErrAuthFailed, fp, o.ReceiverFingerprint)
+		}
+		return trustPinned, nil
+	}
+	if o.KnownReceivers == "" || o.receiverAddress == "" {
+		return trustNone, nil
+	}
+
+	knownReceiversMu.Lock()
+	defer knownReceiversMu.Unlock()
+	pinned, err := readKnownPeers(o.KnownReceivers)
+	if err != nil {
+		return trustNone, fmt.Errorf("error reading known receivers: %w", err)
+	}
+	if known, ok := pinned[o.receiverAddress]; ok {
+		if known != fp {
+			return trustNone, fmt.Errorf("%w: identity of %s changed: pinned %s, got %s (remove the entry from %s if this is expected)",
+				ErrAuthFailed, o.receiverAddress, known, fp, o.KnownReceivers)
+		}
+		return trustPinned, nil
+	}
+	if err := appendKnownPeer(o.KnownReceivers, o.receiverAddress, fp); err != nil {
+		return trustNone, fmt.Errorf("error pinning receiver: %w", err)
+	}
+	return trustFirstUse, nil
+}
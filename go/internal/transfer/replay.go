@@ -0,0 +1,73 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Errors returned by ReplayGuard.Check
+var (
+	errReplayed = errors.New("message was already received")
+	errStale    = errors.New("message timestamp outside the accepted window")
+)
+
+// ReplayGuard rejects handshakes whose timestamp falls outside a window
+// around the local clock or whose nonce was already seen. Seen nonces are
+// kept in a bounded cache; once full the oldest entry is evicted.
+type ReplayGuard struct {
+	window   time.Duration
+	capacity int
+	now      func() time.Time
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	order []string
+
+	rejected atomic.Uint64
+}
+
+// NewReplayGuard creates a guard accepting timestamps within window of now
+// and remembering up to capacity nonces
+func NewReplayGuard(window time.Duration, capacity int) *ReplayGuard {
+	return &ReplayGuard{
+		window:   window,
+		capacity: capacity,
+		now:      time.Now,
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// Check records nonce and returns an error if the message is a replay
+func (g *ReplayGuard) Check(nonce []byte, timestamp time.Time) error {
+	now := g.now()
+	if timestamp.Before(now.Add(-g.window)) || timestamp.After(now.Add(g.window)) {
+		g.rejected.Add(1)
+		return fmt.Errorf("%w (sent %s, skew %s)", errStale, timestamp.Format(time.RFC3339), now.Sub(timestamp).Round(time.Second))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := string(nonce)
+	if _, ok := g.seen[key]; ok {
+		g.rejected.Add(1)
+		return errReplayed
+	}
+
+	// Entries older than the window can go: their timestamps are refused anyway
+	for len(g.order) > 0 && (len(g.order) >= g.capacity || g.seen[g.order[0]].Before(now.Add(-g.window))) {
+		delete(g.seen, g.order[0])
+		g.order = g.order[1:]
+	}
+	g.seen[key] = timestamp
+	g.order = append(g.order, key)
+	return nil
+}
+
+// Rejected returns how many messages the guard has refused
+func (g *ReplayGuard) Rejected() uint64 {
+	return g.rejected.Load()
+}
@@ -0,0 +1,111 @@
+package transfer
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"secure-transfer/internal/metrics"
+)
+
+func TestReplayGuard(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	guard := NewReplayGuard(time.Minute, 2)
+	guard.now = func() time.Time { return now }
+
+	if err := guard.Check([]byte("a"), now); err != nil {
+		t.Fatalf("Fresh message rejected: %v", err)
+	}
+	if err := guard.Check([]byte("a"), now); !errors.Is(err, errReplayed) {
+		t.Errorf("Repeated nonce: got %v, want errReplayed", err)
+	}
+	if err := guard.Check([]byte("b"), now.Add(-2*time.Minute)); !errors.Is(err, errStale) {
+		t.Errorf("Old timestamp: got %v, want errStale", err)
+	}
+	if err := guard.Check([]byte("c"), now.Add(2*time.Minute)); !errors.Is(err, errStale) {
+		t.Errorf("Future timestamp: got %v, want errStale", err)
+	}
+	if got := guard.Rejected(); got != 3 {
+		t.Errorf("Rejected() = %d, want 3", got)
+	}
+
+	// The cache is bounded: the oldest nonce is evicted once it is full
+	guard.Check([]byte("d"), now)
+	guard.Check([]byte("e"), now)
+	if len(guard.seen) != 2 {
+		t.Errorf("Cache holds %d nonces, want 2", len(guard.seen))
+	}
+	if _, ok := guard.seen["a"]; ok {
+		t.Error("Oldest nonce was not evicted")
+	}
+
+	// Entries past the window are dropped as new ones arrive
+	now = now.Add(5 * time.Minute)
+	guard.Check([]byte("f"), now)
+	if len(guard.seen) != 1 {
+		t.Errorf("Cache holds %d nonces after expiry, want 1", len(guard.seen))
+	}
+}
+
+func TestHandshakeRejectsStaleMessage(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+
+	// A receiver whose clock is an hour ahead sees the message as stale
+	guard := NewReplayGuard(time.Minute, 100)
+	guard.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go sendPayload(client, typeMessage, []byte("late"), key, Options{}, logger)
+
+	_, _, err := receivePayload(server, typeMessage, key, Options{Replay: guard}, logger)
+	if !errors.Is(err, errStale) {
+		t.Fatalf("Got %v, want errStale", err)
+	}
+	if guard.Rejected() != 1 {
+		t.Errorf("Rejected() = %d, want 1", guard.Rejected())
+	}
+}
+
+func TestCapturedSessionReplayRejected(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+	guard := NewReplayGuard(time.Minute, 100)
+	metrics := NewMetrics(metrics.NewRegistry())
+	opts := Options{Replay: guard, Metrics: metrics}
+
+	// Record everything a genuine sender writes
+	client, server := net.Pipe()
+	recorder := &recordingConn{Conn: client}
+	go sendPayload(recorder, typeMessage, []byte("pay 100 to alice"), key, Options{}, logger)
+	if _, _, err := receivePayload(server, typeMessage, key, opts, logger); err != nil {
+		t.Fatalf("Failed to receive original transfer: %v", err)
+	}
+	client.Close()
+	server.Close()
+
+	// Play it back byte for byte on a new connection
+	client, server = net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		for _, w := range recorder.writes {
+			if _, err := client.Write(w); err != nil {
+				return
+			}
+		}
+	}()
+	go io.Copy(io.Discard, client)
+
+	_, _, err := receivePayload(server, typeMessage, key, opts, logger)
+	if !errors.Is(err, errReplayed) || !errors.Is(err, ErrReplayed) {
+		t.Fatalf("Replayed session got %v, want errReplayed", err)
+	}
+	if got := metrics.ConnectionsRejected.With(rejectReplay).Value(); got != 1 {
+		t.Errorf("Replay rejections = %d, want 1", got)
+	}
+}
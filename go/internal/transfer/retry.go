@@ -0,0 +1,98 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// Defaults for the zero values of Retry
+const (
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// Retry controls how senders connect to receivers. The zero value makes a
+// single attempt with no timeout beyond the operating system's.
+type Retry struct {
+	// ConnectTimeout bounds each connection attempt, including the TLS
+	// handshake when TLS is used
+	ConnectTimeout time.Duration
+
+	// Retries is the number of attempts made after the first one fails
+	Retries int
+
+	// Backoff is the delay before the first retry, doubled for each
+	// further retry up to MaxBackoff. Every delay is jittered so senders
+	// that failed together don't retry together.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Wait retries until the receiver is reachable, ignoring Retries
+	Wait bool
+}
+
+// delay returns the jittered wait before retry number n, counting from 1
+func (r Retry) delay(n int) time.Duration {
+	base, limit := r.Backoff, r.MaxBackoff
+	if base <= 0 {
+		base = defaultBackoff
+	}
+	if limit <= 0 {
+		limit = defaultMaxBackoff
+	}
+	d := base
+	for i := 1; i < n && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	// Wait at least half the delay and a random part of the rest
+	return d/2 + rand.N(d/2+1)
+}
+
+// dial connects to address following opts.Retry, giving up when ctx is
+// done. Refusals that retrying can't fix, such as a changed TLS
+// certificate, are returned at once.
+func dial(ctx context.Context, address string, opts Options, logger *slog.Logger) (net.Conn, error) {
+	r := opts.Retry
+	for attempt := 1; ; attempt++ {
+		conn, err := dialOnce(ctx, address, opts)
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, ErrAuthFailed) || errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if !r.Wait && attempt > r.Retries {
+			if attempt > 1 {
+				return nil, fmt.Errorf("%w after %d attempts: %w", ErrPeerUnreachable, attempt, err)
+			}
+			return nil, fmt.Errorf("%w: %w", ErrPeerUnreachable, err)
+		}
+
+		delay := r.delay(attempt)
+		logger.Info("Receiver not reachable, retrying", "attempt", attempt, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// dialOnce makes one connection attempt bounded by the connect timeout
+func dialOnce(ctx context.Context, address string, opts Options) (net.Conn, error) {
+	if opts.Retry.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Retry.ConnectTimeout)
+		defer cancel()
+	}
+	return opts.transport().Dial(ctx, address)
+}
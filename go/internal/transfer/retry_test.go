@@ -0,0 +1,130 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"secure-transfer/internal/crypto"
+)
+
+func TestRetryDelay(t *testing.T) {
+	r := Retry{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	testCases := []struct {
+		retry int
+		base  time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for _, tc := range testCases {
+		for range 20 {
+			if d := r.delay(tc.retry); d < tc.base/2 || d > tc.base {
+				t.Errorf("delay(%d) = %v, want between %v and %v", tc.retry, d, tc.base/2, tc.base)
+			}
+		}
+	}
+}
+
+// countingTransport counts dial attempts and always fails with err
+type countingTransport struct {
+	TCPTransport
+	attempts *int
+	err      error
+}
+
+func (t countingTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	*t.attempts++
+	return nil, t.err
+}
+
+func TestDialRetries(t *testing.T) {
+	logger := testLogger(t)
+	retry := Retry{Retries: 2, Backoff: time.Millisecond}
+
+	attempts := 0
+	opts := Options{Retry: retry, Transport: countingTransport{attempts: &attempts, err: errors.New("connection refused")}}
+	if _, err := dial(context.Background(), "127.0.0.1:1", opts, logger); !errors.Is(err, ErrPeerUnreachable) {
+		t.Errorf("Got %v, want ErrPeerUnreachable", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Made %d attempts, want 3", attempts)
+	}
+
+	// Retrying can't fix a refused identity
+	attempts = 0
+	opts.Transport = countingTransport{attempts: &attempts, err: ErrAuthFailed}
+	if _, err := dial(context.Background(), "127.0.0.1:1", opts, logger); !errors.Is(err, ErrAuthFailed) || attempts != 1 {
+		t.Errorf("Got %v after %d attempts, want ErrAuthFailed after 1", err, attempts)
+	}
+}
+
+func TestWaitForReceiver(t *testing.T) {
+	logger := testLogger(t)
+	key, _ := crypto.GenerateKey()
+
+	probe, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := probe.Addr().String()
+	probe.Close()
+
+	// Start the receiver only after the sender began retrying
+	received := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			received <- err
+			return
+		}
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err
+			return
+		}
+		defer conn.Close()
+		_, _, err = receivePayload(conn, typeFile, key, Options{}, logger)
+		received <- err
+	}()
+
+	opts := Options{Retry: Retry{Wait: true, Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}}
+	conn, err := dial(context.Background(), address, opts, logger)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	if _, err := sendPayload(conn, typeFile, []byte("late"), key, opts, logger); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := <-received; err != nil {
+		t.Errorf("Receive failed: %v", err)
+	}
+}
+
+func TestDialCancelledDuringBackoff(t *testing.T) {
+	logger := testLogger(t)
+	attempts := 0
+	opts := Options{
+		Retry:     Retry{Wait: true, Backoff: time.Minute, MaxBackoff: time.Minute},
+		Transport: countingTransport{attempts: &attempts, err: errors.New("connection refused")},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := dial(ctx, "127.0.0.1:1", opts, logger); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("dial returned after %v, ignoring the cancelled context", elapsed)
+	}
+	if attempts != 1 {
+		t.Errorf("Made %d attempts, want 1", attempts)
+	}
+}
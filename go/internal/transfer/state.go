@@ -0,0 +1,155 @@
+package transfer
+
+import (
+	"cmp"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Connection is a connection a server is handling
+type Connection struct {
+	ID   uint64 `json:"id"`
+	Peer string `json:"peer"`
+
+	// Identity is the authenticated sender, empty until the handshake ends
+	Identity string    `json:"identity,omitempty"`
+	Since    time.Time `json:"since"`
+}
+
+// State is the runtime state of an echo server, shared with whatever
+// inspects or steers it while it runs. All methods are safe for
+// concurrent use and do nothing on a nil State.
+type State struct {
+	started         time.Time
+	clipboardPaused atomic.Bool
+	received        atomic.Uint64
+
+	mu          sync.Mutex
+	nextID      uint64
+	connections map[uint64]*Connection
+	key         []byte
+	opts        *Options
+}
+
+// NewState returns the state of a server starting now
+func NewState() *State {
+	return &State{started: time.Now(), connections: make(map[uint64]*Connection)}
+}
+
+// Started returns when the server started
+func (s *State) Started() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	return s.started
+}
+
+// PauseClipboard stops or resumes clipboard writes whatever the clipboard
+// policy
+func (s *State) PauseClipboard(paused bool) {
+	if s != nil {
+		s.clipboardPaused.Store(paused)
+	}
+}
+
+// ClipboardPaused reports whether clipboard writes are paused
+func (s *State) ClipboardPaused() bool {
+	return s != nil && s.clipboardPaused.Load()
+}
+
+// Received returns the number of items received
+func (s *State) Received() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.received.Load()
+}
+
+// Connections returns the open connections, oldest first
+func (s *State) Connections() []Connection {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connections := make([]Connection, 0, len(s.connections))
+	for _, c := range s.connections {
+		connections = append(connections, *c)
+	}
+	slices.SortFunc(connections, func(a, b Connection) int { return cmp.Compare(a.ID, b.ID) })
+	return connections
+}
+
+// Update replaces the key and options used for connections accepted from
+// now on, e.g. after the configuration was reloaded
+func (s *State) Update(key []byte, opts Options) {
+	if s == nil {
+		return
+	}
+	opts.State = s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key, s.opts = key, &opts
+}
+
+// Current returns the key and options last passed to Update, or the
+// given ones if there was no update
+func (s *State) Current(key []byte, opts Options) ([]byte, Options) {
+	if s == nil {
+		return key, opts
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts == nil {
+		return key, opts
+	}
+	return s.key, *s.opts
+}
+
+// track records conn as open and returns its ID
+func (s *State) track(conn net.Conn) uint64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	s.connections[s.nextID] = &Connection{ID: s.nextID, Peer: conn.RemoteAddr().String(), Since: time.Now()}
+	return s.nextID
+}
+
+// identify records the authenticated sender of connection id
+func (s *State) identify(id uint64, sess session) {
+	if s == nil {
+		return
+	}
+	name := sess.peer.Name
+	if name == "" {
+		name = sess.peer.Fingerprint()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.connections[id]; ok {
+		c.Identity = name
+	}
+}
+
+// untrack forgets a closed connection
+func (s *State) untrack(id uint64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.connections, id)
+}
+
+// countReceived counts an item received
+func (s *State) countReceived() {
+	if s != nil {
+		s.received.Add(1)
+	}
+}
@@ -0,0 +1,74 @@
+package transfer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"secure-transfer/internal/crypto"
+)
+
+func TestStateTracksAndReloads(t *testing.T) {
+	logger := testLogger(t)
+	oldKey, _ := crypto.GenerateKey()
+	newKey, _ := crypto.GenerateKey()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	state := NewState()
+	go ServeEcho(listener, oldKey, Options{State: state, Clipboard: ClipboardNever}, logger)
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if err := SendMessage("127.0.0.1", port, "", "first", oldKey, Options{}, logger); err != nil {
+		t.Fatalf("Failed to send with the original key: %v", err)
+	}
+
+	state.Update(newKey, Options{Clipboard: ClipboardNever})
+	if err := SendMessage("127.0.0.1", port, "", "second", newKey, Options{}, logger); err != nil {
+		t.Fatalf("Failed to send with the reloaded key: %v", err)
+	}
+	if err := SendMessage("127.0.0.1", port, "", "third", oldKey, Options{}, logger); err == nil {
+		t.Error("Replaced key still accepted")
+	}
+
+	if got := state.Received(); got != 2 {
+		t.Errorf("Received = %d, want 2", got)
+	}
+	// Handlers forget connections just after answering the sender
+	deadline := time.Now().Add(time.Second)
+	for len(state.Connections()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if connections := state.Connections(); len(connections) != 0 {
+		t.Errorf("Closed connections still listed: %+v", connections)
+	}
+
+	// Reloaded limits apply to the connections accepted after them
+	state.Update(newKey, Options{Clipboard: ClipboardNever, Limits: Limits{RatePerIP: 0.001, Burst: 1}})
+	if err := SendMessage("127.0.0.1", port, "", "fourth", newKey, Options{}, logger); err != nil {
+		t.Fatalf("Failed to send within the reloaded rate: %v", err)
+	}
+	if err := SendMessage("127.0.0.1", port, "", "fifth", newKey, Options{}, logger); err == nil {
+		t.Error("Send beyond the reloaded rate was accepted")
+	}
+}
+
+func TestPausedClipboard(t *testing.T) {
+	logger := testLogger(t)
+	state := NewState()
+	state.PauseClipboard(true)
+
+	copied, err := Options{State: state, Clipboard: ClipboardAlways}.copyToClipboard([]byte("held back"), logger)
+	if copied || err != nil {
+		t.Errorf("Paused copy = %v, %v; want nothing copied and no error", copied, err)
+	}
+
+	var disabled *State
+	disabled.PauseClipboard(true)
+	if disabled.ClipboardPaused() {
+		t.Error("Nil state reports paused clipboard")
+	}
+}
@@ -2,90 +2,381 @@ package transfer
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
+	"secure-transfer/internal/audit"
 	"secure-transfer/internal/clipboard"
+	"secure-transfer/internal/compress"
 	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/identity"
+	"secure-transfer/internal/notify"
 )
 
-// SendFile sends a file over TCP
-func SendFile(ip string, port int, filePath string, key []byte, logger *slog.Logger) error {
-	logger.Info("Sending file", "ip", ip, "port", port, "file", filePath)
+// Clipboard policies for received content
+const (
+	ClipboardAuto   = "auto"
+	ClipboardAlways = "always"
+	ClipboardNever  = "never"
+)
 
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", ip, port))
-	if err != nil {
-		return fmt.Errorf("connection error: %w", err)
+// clipboardAutoLimit is the largest payload ClipboardAuto copies
+const clipboardAutoLimit = 1024 * 1024
+
+// ValidateClipboardPolicy checks policy is one of the clipboard policies
+func ValidateClipboardPolicy(policy string) error {
+	switch policy {
+	case ClipboardAuto, ClipboardAlways, ClipboardNever:
+		return nil
 	}
-	defer conn.Close()
+	return fmt.Errorf("unknown clipboard policy %q (want auto, always or never)", policy)
+}
 
-	fileData, err := os.ReadFile(filePath)
+// Options holds per-transfer settings
+type Options struct {
+	// Compression is the sender's compression mode: auto, zstd, gzip or none
+	Compression string
+
+	// Cipher restricts the cipher suite to one of crypto.SupportedCiphers;
+	// any supported suite is negotiated when empty
+	Cipher string
+
+	// Transport carries the connection; plain TCP when nil
+	Transport Transport
+
+	// Identity proves who we are during the handshake; an ephemeral
+	// identity is generated when nil
+	Identity *identity.Identity
+
+	// PreviousKeys are retired keys still accepted when receiving
+	PreviousKeys [][]byte
+
+	// Passphrase, when set, replaces the shared key with one derived per
+	// transfer using a salt exchanged in the handshake
+	Passphrase string
+
+	// KDF are the Argon2id costs a sender uses; crypto.DefaultKDFParams when zero
+	KDF crypto.KDFParams
+
+	// Replay, when set, rejects stale or repeated handshakes
+	Replay *ReplayGuard
+
+	// Limits bound what receivers accept
+	Limits Limits
+
+	// Retry controls how senders connect and retry unreachable receivers
+	Retry Retry
+
+	// Access restricts which addresses receivers accept connections from
+	Access AccessList
+
+	// Bind is the address receivers listen on; all interfaces when empty
+	Bind string
+
+	// Clipboard is the clipboard policy for received content; ClipboardAuto
+	// when empty
+	Clipboard string
+
+	// Audit, when set, records every item received
+	Audit *audit.Log
+
+	// History, when set, keeps recently received messages
+	History *History
+
+	// Metrics, when set, counts connections, bytes and failures
+	Metrics *Metrics
+
+	// Approval, when set, holds received items until they are approved
+	Approval *Approval
+
+	// Notifier, when set, tells the user about every item accepted
+	Notifier notify.Notifier
+
+	// NotifyPreview includes the start of the content in notifications
+	NotifyPreview bool
+
+	// State, when set, tracks connections and lets a running echo server
+	// be paused or reconfigured
+	State *State
+
+	// ReceiverFingerprint, when set, is the identity fingerprint a sender
+	// requires the receiver to prove
+	ReceiverFingerprint string
+
+	// KnownReceivers, when set, is the file where senders pin each
+	// receiver's identity by address. A receiver is trusted on first use
+	// and refused if it later proves a different identity.
+	// ReceiverFingerprint takes precedence.
+	KnownReceivers string
+
+	// Sighted, when set, is told the address and identity fingerprint of
+	// every peer that proves its identity in a handshake. Senders report
+	// the address they dialed; receivers only know the sender's host.
+	Sighted func(address, fingerprint string)
+
+	// AuthorizedPeers is the path of the authorized peers file. When the
+	// file lists peers receivers only accept senders listed in it;
+	// senders ignore it.
+	AuthorizedPeers string
+
+	// receiverAddress is the address a send dialed, which KnownReceivers
+	// pins identities by
+	receiverAddress string
+}
+
+// transport returns the configured transport, defaulting to TCP
+func (o Options) transport() Transport {
+	if o.Transport == nil {
+		return TCPTransport{}
+	}
+	return o.Transport
+}
+
+// ciphers returns the cipher suites this side offers or accepts
+func (o Options) ciphers() []string {
+	if o.Cipher == "" {
+		return crypto.SupportedCiphers
+	}
+	return []string{o.Cipher}
+}
+
+// listenAddress returns the address receivers listen on
+func (o Options) listenAddress(port int) string {
+	bind := o.Bind
+	if bind == "" {
+		bind = "0.0.0.0"
+	}
+	return net.JoinHostPort(bind, strconv.Itoa(port))
+}
+
+// kdfParams returns the configured key derivation costs
+func (o Options) kdfParams() crypto.KDFParams {
+	if o.KDF == (crypto.KDFParams{}) {
+		return crypto.DefaultKDFParams
+	}
+	return o.KDF
+}
+
+// identity returns the configured identity or a fresh ephemeral one
+func (o Options) identity() (*identity.Identity, error) {
+	if o.Identity != nil {
+		return o.Identity, nil
+	}
+	return identity.Generate()
+}
+
+// copyToClipboard copies received content as the clipboard policy allows,
+// reporting whether it was copied and why copying failed
+func (o Options) copyToClipboard(data []byte, logger *slog.Logger) (bool, error) {
+	if o.State.ClipboardPaused() {
+		logger.Info("Clipboard writes paused, not copying content")
+		return false, nil
+	}
+	switch o.Clipboard {
+	case ClipboardNever:
+		return false, nil
+	case ClipboardAlways:
+	default:
+		if len(data) >= clipboardAutoLimit {
+			logger.Info("Content too large to copy to clipboard", "bytes", len(data))
+			return false, nil
+		}
+	}
+
+	if err := clipboard.CopyToClipboard(string(data)); err != nil {
+		o.metrics().ClipboardFailures.Inc()
+		logger.Warn("Could not copy to clipboard", "error", err)
+		return false, err
+	}
+	logger.Info("Copied content to clipboard")
+	return true, nil
+}
+
+// recordReceipt appends a received item and what was done with it to the
+// audit log. Failures are logged rather than returned as the item has
+// already been handled.
+func (o Options) recordReceipt(conn net.Conn, sess session, transferType string, data []byte, savedAs string, actions []string, logger *slog.Logger) {
+	if o.Audit == nil {
+		return
+	}
+	entry := audit.Entry{
+		Time:        time.Now(),
+		Remote:      conn.RemoteAddr().String(),
+		Peer:        sess.peer.Name,
+		Fingerprint: sess.peer.Fingerprint(),
+		SessionID:   sess.logID(),
+		Type:        transferType,
+		Size:        len(data),
+		SHA256:      audit.ContentHash(data),
+		Actions:     []string{},
+	}
+	if savedAs != "" {
+		entry.Actions = append(entry.Actions, audit.ActionSaved)
+		if abs, err := filepath.Abs(savedAs); err == nil {
+			savedAs = abs
+		}
+		entry.Path = savedAs
+	}
+	entry.Actions = append(entry.Actions, actions...)
+	if err := o.Audit.Append(entry); err != nil {
+		logger.Error("Could not write audit log entry", "error", err)
+	}
+}
+
+// clipboardActions returns the audit action for a clipboard copy
+func clipboardActions(copied bool) []string {
+	if copied {
+		return []string{audit.ActionClipboard}
+	}
+	return nil
+}
+
+// notify tells the user about an accepted item. Failures are logged
+// rather than returned as the item has already been handled.
+func (o Options) notify(sess session, transferType string, data []byte, savedAs string, copied bool, logger *slog.Logger) {
+	if o.Notifier == nil {
+		return
+	}
+	n := notify.Notification{
+		Sender: sess.peer.Name,
+		Type:   transferType,
+		Size:   len(data),
+		Path:   savedAs,
+		Copied: copied,
+	}
+	if n.Sender == "" {
+		n.Sender = sess.peer.Fingerprint()
+	}
+	if o.NotifyPreview {
+		n.Preview = preview(data)
+	}
+	if err := o.Notifier.Notify(n); err != nil {
+		logger.Warn("Could not show notification", "error", err)
+	}
+}
+
+// sighted reports a peer that proved its identity at address to Sighted
+func (o Options) sighted(address string, peer identity.Peer) {
+	if o.Sighted != nil && address != "" {
+		o.Sighted(address, peer.Fingerprint())
+	}
+}
+
+// authorizePeer checks a peer's key against the authorized peers file,
+// which is re-read on every connection so edits apply immediately
+func (o Options) authorizePeer(publicKey ed25519.PublicKey) (identity.Peer, error) {
+	anonymous := identity.Peer{PublicKey: publicKey}
+	if o.AuthorizedPeers == "" {
+		return anonymous, nil
+	}
+	peers, enforced, err := identity.LoadAllowList(o.AuthorizedPeers)
 	if err != nil {
-		return fmt.Errorf("error reading file: %w", err)
+		return anonymous, fmt.Errorf("error reading authorized peers: %w", err)
+	}
+	if !enforced {
+		return anonymous, nil
 	}
+	peer, ok := identity.FindPeer(peers, publicKey)
+	if !ok {
+		return anonymous, fmt.Errorf("%w: peer %s is not authorized", ErrAuthFailed, anonymous.Fingerprint())
+	}
+	return peer, nil
+}
 
-	encryptedData, err := crypto.Encrypt(fileData, key)
+// SendFile sends a file over TCP
+func SendFile(ip string, port int, filePath string, key []byte, opts Options, logger *slog.Logger) error {
+	return SendFileContext(context.Background(), ip, port, filePath, key, opts, logger)
+}
+
+// SendFileContext is SendFile, abandoning the connection attempts or the
+// transfer when ctx is done and then returning ctx.Err()
+func SendFileContext(ctx context.Context, ip string, port int, filePath string, key []byte, opts Options, logger *slog.Logger) (err error) {
+	defer func() { err = ContextError(ctx, err) }()
+	address := net.JoinHostPort(ip, strconv.Itoa(port))
+	opts.receiverAddress = address
+	logger = logger.With("peer", address)
+	logger.Info("Sending file", "file", filePath)
+	start := time.Now()
+
+	fileData, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("encryption error: %w", err)
+		return fmt.Errorf("error reading file: %w", err)
 	}
 
-	// Send file size first
-	size := make([]byte, 8)
-	copy(size, fmt.Sprintf("%08d", len(encryptedData)))
-	_, err = conn.Write(size)
+	conn, err := dial(ctx, address, opts, logger)
 	if err != nil {
-		return fmt.Errorf("error sending file size: %w", err)
+		return err
 	}
+	defer conn.Close()
+	// Closing the connection unblocks whatever is reading or writing it
+	defer context.AfterFunc(ctx, func() { conn.Close() })()
 
-	// Send encrypted file
-	_, err = conn.Write(encryptedData)
+	sess, err := sendPayload(conn, typeFile, fileData, key, opts, logger)
 	if err != nil {
-		return fmt.Errorf("error sending file data: %w", err)
+		return err
 	}
 
-	logger.Info("File sent successfully!")
+	opts.metrics().BytesSent.Add(uint64(len(fileData)))
+	opts.metrics().observe("send", start)
+	logger.Info("File sent", "session_id", sess.logID(), "bytes", len(fileData), "duration", time.Since(start))
 	return nil
 }
 
 // ReceiveFile receives a file over TCP
-func ReceiveFile(port int, saveAs string, key []byte, logger *slog.Logger) error {
-	logger.Info("Starting file receiver", "port", port, "saveAs", saveAs)
+func ReceiveFile(port int, saveAs string, key []byte, opts Options, logger *slog.Logger) error {
+	logger.Info("Starting file receiver", "port", port, "file", saveAs)
 
-	listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+	listener, err := opts.transport().Listen(opts.listenAddress(port))
 	if err != nil {
 		return fmt.Errorf("error starting server: %w", err)
 	}
 	defer listener.Close()
 
-	logger.Info("Waiting for connection", "port", port)
-	conn, err := listener.Accept()
-	if err != nil {
-		return fmt.Errorf("connection error: %w", err)
+	return ReceiveFileFrom(listener, saveAs, key, opts, logger)
+}
+
+// ReceiveFileFrom receives one file from a connection accepted on listener
+func ReceiveFileFrom(listener net.Listener, saveAs string, key []byte, opts Options, logger *slog.Logger) error {
+	logger.Info("Waiting for connection", "address", listener.Addr())
+	var conn net.Conn
+	var err error
+	for {
+		conn, err = listener.Accept()
+		if err != nil {
+			return fmt.Errorf("connection error: %w", err)
+		}
+		if opts.Access.permitsConn(conn) {
+			break
+		}
+		opts.metrics().rejected(rejectACL)
+		logger.Warn("Rejected connection from disallowed address", "peer", conn.RemoteAddr().String())
+		conn.Close()
 	}
 	defer conn.Close()
+	conn = withDeadlines(conn, opts.Limits)
+	opts.metrics().ConnectionsAccepted.Inc()
 
-	logger.Info("Connection established", "from", conn.RemoteAddr())
-
-	// Read file size first
-	sizeBuf := make([]byte, 8)
-	_, err = io.ReadFull(conn, sizeBuf)
-	if err != nil {
-		return fmt.Errorf("error reading file size: %w", err)
-	}
+	start := time.Now()
+	logger = logger.With("peer", conn.RemoteAddr().String())
+	logger.Info("Connection established")
 
-	// Read encrypted file data
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, conn)
+	decryptedData, sess, err := receivePayload(conn, typeFile, key, opts, logger)
 	if err != nil {
-		return fmt.Errorf("error receiving file: %w", err)
+		return err
 	}
 
-	decryptedData, err := crypto.Decrypt(buf.Bytes(), key)
-	if err != nil {
-		return fmt.Errorf("decryption error: %w", err)
+	if !opts.Approval.approve(conn, sess, typeFile, decryptedData) {
+		logger.Info("File rejected", "session_id", sess.logID(), "bytes", len(decryptedData))
+		opts.recordReceipt(conn, sess, typeFile, decryptedData, "", []string{audit.ActionRejected}, logger)
+		return fmt.Errorf("%w: file not saved", ErrRejected)
 	}
 
 	err = os.WriteFile(saveAs, decryptedData, 0644)
@@ -93,114 +384,164 @@ func ReceiveFile(port int, saveAs string, key []byte, logger *slog.Logger) error
 		return fmt.Errorf("error saving file: %w", err)
 	}
 
-	// Try to copy the content to clipboard
-	if len(decryptedData) < 1024*1024 { // Only copy if less than 1MB
-		err = clipboard.CopyToClipboard(string(decryptedData))
-		if err != nil {
-			logger.Warn("Could not copy to clipboard", "error", err)
-		} else {
-			logger.Info("Copied file content to clipboard")
-		}
-	} else {
-		logger.Info("File too large to copy to clipboard")
+	logger = logger.With("session_id", sess.logID())
+	opts.metrics().BytesReceived.Add(uint64(len(decryptedData)))
+	copied, clipboardErr := opts.copyToClipboard(decryptedData, logger)
+	opts.recordReceipt(conn, sess, typeFile, decryptedData, saveAs, clipboardActions(copied), logger)
+	opts.notify(sess, typeFile, decryptedData, saveAs, copied, logger)
+	opts.metrics().observe("receive", start)
+	// The always policy makes the clipboard copy part of a successful receive
+	if clipboardErr != nil && opts.Clipboard == ClipboardAlways {
+		return fmt.Errorf("file saved as %s but %w", saveAs, clipboardErr)
 	}
 
-	logger.Info("File received and saved", "filename", saveAs)
+	logger.Info("File received and saved", "file", saveAs, "bytes", len(decryptedData), "duration", time.Since(start))
 	return nil
 }
 
 // EchoResponse starts an echo server
-func EchoResponse(port int, key []byte, logger *slog.Logger) error {
+func EchoResponse(port int, key []byte, opts Options, logger *slog.Logger) error {
 	logger.Info("Starting echo server", "port", port)
 
-	listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+	listener, err := opts.transport().Listen(opts.listenAddress(port))
 	if err != nil {
 		return fmt.Errorf("error starting server: %w", err)
 	}
 	defer listener.Close()
 
-	logger.Info("Waiting for connection", "port", port)
+	return ServeEcho(listener, key, opts, logger)
+}
+
+// ServeEcho handles echo connections accepted on listener until it is closed
+func ServeEcho(listener net.Listener, key []byte, opts Options, logger *slog.Logger) error {
+	logger.Info("Waiting for connection", "address", listener.Addr())
 
+	limiter := newConnLimiter(opts.Limits)
 	for {
 		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
 		if err != nil {
 			logger.Error("Connection error", "error", err)
 			continue
 		}
+		// Pick up options reloaded since the server started
+		key, opts := opts.State.Current(key, opts)
+		limiter.update(opts.Limits)
+
+		if !opts.Access.permitsConn(conn) {
+			opts.metrics().rejected(rejectACL)
+			logger.Warn("Rejected connection from disallowed address", "peer", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+		if !limiter.allowIP(remoteIP(conn)) {
+			opts.metrics().rejected(rejectRate)
+			logger.Warn("Rate limit exceeded, closing connection", "peer", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+		if !limiter.acquire() {
+			opts.metrics().rejected(rejectCapacity)
+			logger.Warn("Too many connections, closing connection", "peer", conn.RemoteAddr().String(), "max", opts.Limits.MaxConnections)
+			conn.Close()
+			continue
+		}
 
-		go handleEchoConnection(conn, key, logger)
+		opts.metrics().ConnectionsAccepted.Inc()
+		opts.metrics().ActiveConnections.Add(1)
+		go func() {
+			defer limiter.release()
+			defer opts.metrics().ActiveConnections.Add(-1)
+			handleEchoConnection(withDeadlines(conn, opts.Limits), key, opts, logger)
+		}()
 	}
 }
 
 // handleEchoConnection handles a single echo connection
-func handleEchoConnection(conn net.Conn, key []byte, logger *slog.Logger) {
+func handleEchoConnection(conn net.Conn, key []byte, opts Options, logger *slog.Logger) {
 	defer conn.Close()
-	logger.Info("Connection established", "from", conn.RemoteAddr())
-
-	// Read file size first
-	sizeBuf := make([]byte, 8)
-	_, err := io.ReadFull(conn, sizeBuf)
-	if err != nil {
-		logger.Error("Error reading message size", "error", err)
+	id := opts.State.track(conn)
+	defer opts.State.untrack(id)
+	start := time.Now()
+	logger = logger.With("peer", conn.RemoteAddr().String())
+	logger.Info("Connection established")
+
+	decryptedData, sess, err := receivePayload(conn, typeMessage, key, opts, logger)
+	if errors.Is(err, errReplayed) || errors.Is(err, errStale) {
+		logger.Warn("Rejected replayed message", "error", err, "rejected_total", opts.Replay.Rejected())
 		return
 	}
-
-	// Read encrypted data
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, conn)
 	if err != nil {
-		logger.Error("Error receiving data", "error", err)
-		return
-	}
-
-	decryptedData, err := crypto.Decrypt(buf.Bytes(), key)
-	if err != nil {
-		logger.Error("Decryption error", "error", err)
+		logger.Error("Error receiving message", "error", err)
 		return
 	}
 
+	logger = logger.With("session_id", sess.logID())
+	opts.State.identify(id, sess)
+	opts.State.countReceived()
 	message := string(decryptedData)
-	logger.Info("Received message", "length", len(message))
+	logger.Info("Received message", "bytes", len(message))
+	opts.metrics().BytesReceived.Add(uint64(len(decryptedData)))
 
-	// Copy to clipboard
-	err = clipboard.CopyToClipboard(message)
-	if err != nil {
-		logger.Warn("Could not copy to clipboard", "error", err)
+	response := fmt.Sprintf("Received message (%d bytes)", len(message))
+	if opts.Approval.approve(conn, sess, typeMessage, decryptedData) {
+		copied, _ := opts.copyToClipboard(decryptedData, logger)
+		opts.recordReceipt(conn, sess, typeMessage, decryptedData, "", clipboardActions(copied), logger)
+		opts.History.add(Received{
+			Time:        time.Now(),
+			Remote:      conn.RemoteAddr().String(),
+			Peer:        sess.peer.Name,
+			Fingerprint: sess.peer.Fingerprint(),
+			Type:        typeMessage,
+			Size:        len(decryptedData),
+			Content:     message,
+		})
+		// Deferred so the sender has its answer before a slow
+		// notification command runs
+		defer opts.notify(sess, typeMessage, decryptedData, "", copied, logger)
 	} else {
-		logger.Info("Copied message to clipboard")
+		logger.Info("Message rejected")
+		opts.recordReceipt(conn, sess, typeMessage, decryptedData, "", []string{audit.ActionRejected}, logger)
+		response = responseRejected
 	}
 
 	// Send response back
-	response := fmt.Sprintf("Received message (%d bytes)", len(message))
-	encryptedResponse, err := crypto.Encrypt([]byte(response), key)
+	// Answer with the key the sender used, which may be a retired one
+	encryptedResponse, err := sess.seal(frameTypeResponse, []byte(response))
 	if err != nil {
 		logger.Error("Encryption error", "error", err)
 		return
 	}
 
-	// Send response size
-	respSize := make([]byte, 8)
-	copy(respSize, fmt.Sprintf("%08d", len(encryptedResponse)))
-	conn.Write(respSize)
-
-	// Send encrypted response
-	conn.Write(encryptedResponse)
-	logger.Info("Sent response to client")
+	if err := writeFrame(conn, encryptedResponse); err != nil {
+		logger.Error("Error sending response", "error", err)
+		return
+	}
+	opts.metrics().observe("receive", start)
+	logger.Info("Sent response to client", "duration", time.Since(start))
 }
 
 // SendMessage sends a message to the echo server
-func SendMessage(ip string, port int, filePath string, message string, key []byte, logger *slog.Logger) error {
-	logger.Info("Sending message", "ip", ip, "port", port)
+func SendMessage(ip string, port int, filePath string, message string, key []byte, opts Options, logger *slog.Logger) error {
+	return SendMessageContext(context.Background(), ip, port, filePath, message, key, opts, logger)
+}
 
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", ip, port))
-	if err != nil {
-		return fmt.Errorf("connection error: %w", err)
-	}
-	defer conn.Close()
+// SendMessageContext is SendMessage, abandoning the connection attempts
+// or the exchange when ctx is done and then returning ctx.Err()
+func SendMessageContext(ctx context.Context, ip string, port int, filePath string, message string, key []byte, opts Options, logger *slog.Logger) (err error) {
+	defer func() { err = ContextError(ctx, err) }()
+	address := net.JoinHostPort(ip, strconv.Itoa(port))
+	opts.receiverAddress = address
+	logger = logger.With("peer", address)
+	logger.Info("Sending message")
+	start := time.Now()
 
 	var messageData []byte
 	if filePath != "" {
 		// Read from file
+		var err error
 		messageData, err = os.ReadFile(filePath)
 		if err != nil {
 			return fmt.Errorf("error reading file: %w", err)
@@ -210,46 +551,147 @@ func SendMessage(ip string, port int, filePath string, message string, key []byt
 		messageData = []byte(message)
 	}
 
-	encryptedData, err := crypto.Encrypt(messageData, key)
+	conn, err := dial(ctx, address, opts, logger)
 	if err != nil {
-		return fmt.Errorf("encryption error: %w", err)
+		return err
 	}
+	defer conn.Close()
+	// Closing the connection unblocks whatever is reading or writing it
+	defer context.AfterFunc(ctx, func() { conn.Close() })()
 
-	// Send message size first
-	size := make([]byte, 8)
-	copy(size, fmt.Sprintf("%08d", len(encryptedData)))
-	_, err = conn.Write(size)
+	sess, err := sendPayload(conn, typeMessage, messageData, key, opts, logger)
 	if err != nil {
-		return fmt.Errorf("error sending message size: %w", err)
+		return err
 	}
 
-	// Send encrypted message
-	_, err = conn.Write(encryptedData)
+	logger = logger.With("session_id", sess.logID())
+	opts.metrics().BytesSent.Add(uint64(len(messageData)))
+	logger.Info("Message sent", "bytes", len(messageData))
+
+	// Read encrypted response
+	encryptedResp, err := readFrame(conn, maxHandshakeFrame)
 	if err != nil {
-		return fmt.Errorf("error sending message: %w", err)
+		return fmt.Errorf("error receiving response: %w", err)
 	}
 
-	logger.Info("Message sent", "bytes", len(messageData))
+	decryptedResp, err := sess.open(frameTypeResponse, encryptedResp)
+	if err != nil {
+		return fmt.Errorf("%w: response decryption error: %w", ErrIntegrity, err)
+	}
+
+	if string(decryptedResp) == responseRejected {
+		return fmt.Errorf("%w: message declined by %s", ErrRejected, address)
+	}
+	opts.metrics().observe("send", start)
+	logger.Info("Response received", "message", string(decryptedResp), "duration", time.Since(start))
+	return nil
+}
+
+// ContextError prefers ctx's error when ctx ended the operation
+func ContextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
 
-	// Read response size
-	respSizeBuf := make([]byte, 8)
-	_, err = io.ReadFull(conn, respSizeBuf)
+// sendPayload negotiates the transfer, then compresses, encrypts and writes data.
+// The returned session holds the key used, for decrypting any response.
+func sendPayload(conn net.Conn, transferType string, data []byte, key []byte, opts Options, logger *slog.Logger) (session, error) {
+	mode, err := compress.ParseMode(opts.Compression)
 	if err != nil {
-		return fmt.Errorf("error reading response size: %w", err)
+		return session{}, err
 	}
 
-	// Read encrypted response
-	var respBuf bytes.Buffer
-	_, err = io.Copy(&respBuf, conn)
+	sess, err := clientHandshake(conn, transferType, compress.Offer(mode, data), opts)
 	if err != nil {
-		return fmt.Errorf("error receiving response: %w", err)
+		return sess, err
+	}
+	opts.sighted(opts.receiverAddress, sess.peer)
+	attrs := []any{"session_id", sess.logID(), "identity", peerName(sess.peer), "cipher", sess.suite().Name()}
+	switch sess.receiverTrust {
+	case trustPinned:
+		logger.Info("Receiver authenticated", attrs...)
+	case trustFirstUse:
+		logger.Warn("Trusting new receiver on first use", attrs...)
+	default:
+		logger.Warn("Receiver identity not verified, pin its fingerprint to detect impersonation", attrs...)
 	}
 
-	decryptedResp, err := crypto.Decrypt(respBuf.Bytes(), key)
+	compressed, err := compress.Compress(sess.compression, data)
 	if err != nil {
-		return fmt.Errorf("response decryption error: %w", err)
+		return sess, fmt.Errorf("compression error: %w", err)
 	}
+	logger.Debug("Compressed payload", "algorithm", sess.compression, "bytes", len(data), "compressed", len(compressed))
 
-	logger.Info("Response received", "message", string(decryptedResp))
-	return nil
+	if sess.key == nil {
+		sess.key = key
+	}
+	encryptedData, err := sess.seal(frameTypeData, compressed)
+	if err != nil {
+		return sess, fmt.Errorf("encryption error: %w", err)
+	}
+	if sess.maxPayload > 0 && len(encryptedData) > sess.maxPayload {
+		return sess, fmt.Errorf("%w: payload is %d bytes, receiver accepts %d", ErrTooLarge, len(encryptedData), sess.maxPayload)
+	}
+
+	if err := writeFrame(conn, encryptedData); err != nil {
+		return sess, fmt.Errorf("error sending data: %w", err)
+	}
+	return sess, nil
+}
+
+// receivePayload answers the handshake, then reads, decrypts and decompresses data
+func receivePayload(conn net.Conn, transferType string, key []byte, opts Options, logger *slog.Logger) ([]byte, session, error) {
+	sess, err := serverHandshake(conn, transferType, opts)
+	if err != nil {
+		opts.metrics().handshakeFailed(err)
+		return nil, sess, err
+	}
+	logger.Info("Sender authenticated", "session_id", sess.logID(), "identity", peerName(sess.peer), "cipher", sess.suite().Name())
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		opts.sighted(host, sess.peer)
+	}
+
+	encryptedData, err := readFrame(conn, sess.maxPayload)
+	if err != nil {
+		return nil, sess, fmt.Errorf("error receiving data: %w", err)
+	}
+
+	var compressed []byte
+	if sess.key != nil {
+		compressed, err = sess.open(frameTypeData, encryptedData)
+	} else {
+		for _, candidate := range append([][]byte{key}, opts.PreviousKeys...) {
+			sess.key = candidate
+			if compressed, err = sess.open(frameTypeData, encryptedData); err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		opts.metrics().DecryptionFailures.Inc()
+		return nil, sess, fmt.Errorf("%w: decryption error: %w", ErrIntegrity, err)
+	}
+	if opts.Passphrase == "" && !bytes.Equal(sess.key, key) {
+		logger.Warn("Sender used a retired key", "session_id", sess.logID(), "identity", peerName(sess.peer), "key_id", crypto.KeyID(sess.key))
+	}
+
+	data, err := compress.Decompress(sess.compression, compressed, sess.maxPayload)
+	if errors.Is(err, compress.ErrTooLarge) {
+		return nil, sess, fmt.Errorf("%w: %w", ErrTooLarge, err)
+	}
+	if err != nil {
+		return nil, sess, fmt.Errorf("decompression error: %w", err)
+	}
+	logger.Debug("Decompressed payload", "algorithm", sess.compression, "compressed", len(compressed), "bytes", len(data))
+	return data, sess, nil
+}
+
+// peerName describes a peer by name when it is authorized, else by fingerprint
+func peerName(peer identity.Peer) string {
+	if peer.Name != "" {
+		return peer.Name
+	}
+	return peer.Fingerprint()
 }
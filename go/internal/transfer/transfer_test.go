@@ -3,18 +3,34 @@ package transfer
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"secure-transfer/internal/audit"
+	"secure-transfer/internal/compress"
 	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/identity"
+	"secure-transfer/internal/notify"
 )
 
+// testLogger returns a logger discarding everything tests log
+func testLogger(t *testing.T) *slog.Logger {
+	t.Helper()
+	return slog.New(slog.DiscardHandler)
+}
+
 // Setup a mock server/client for testing
 func setupTestServerClient(t *testing.T) (int, []byte) {
 	// Find an available port
@@ -101,24 +117,7 @@ func TestSendReceiveIntegration(t *testing.T) {
 		case conn := <-connChan:
 			defer conn.Close()
 
-			// Read file size
-			sizeBuf := make([]byte, 8)
-			_, err = io.ReadFull(conn, sizeBuf)
-			if err != nil {
-				serverErr = err
-				return
-			}
-
-			// Read encrypted data
-			var buf bytes.Buffer
-			_, err = io.Copy(&buf, conn)
-			if err != nil {
-				serverErr = err
-				return
-			}
-
-			// Decrypt
-			decrypted, err := crypto.Decrypt(buf.Bytes(), key)
+			decrypted, _, err := receivePayload(conn, typeFile, key, Options{}, logger)
 			if err != nil {
 				serverErr = err
 				return
@@ -137,7 +136,7 @@ func TestSendReceiveIntegration(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Send the file
-	err = SendFile("localhost", port, testFile, key, logger)
+	err = SendFile("localhost", port, testFile, key, Options{}, logger)
 	if err != nil {
 		t.Fatalf("Failed to send file: %v", err)
 	}
@@ -161,3 +160,656 @@ func TestSendReceiveIntegration(t *testing.T) {
 			received, testContent)
 	}
 }
+
+func TestCompressedPayloadRoundTrip(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+
+	text := bytes.Repeat([]byte("2025-01-01 INFO request served in 3ms\n"), 1000)
+	random := make([]byte, 64*1024)
+	rand.Read(random)
+
+	testCases := []struct {
+		name string
+		data []byte
+		mode string
+	}{
+		{"Auto text", text, compress.Auto},
+		{"Zstd text", text, compress.Zstd},
+		{"Gzip text", text, compress.Gzip},
+		{"None text", text, compress.None},
+		{"Auto incompressible", random, compress.Auto},
+		{"Zstd incompressible", random, compress.Zstd},
+		{"Empty", []byte{}, compress.Auto},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := sendPayload(client, typeFile, tc.data, key, Options{Compression: tc.mode}, logger)
+				errChan <- err
+			}()
+
+			received, _, err := receivePayload(server, typeFile, key, Options{}, logger)
+			if err != nil {
+				t.Fatalf("Failed to receive payload: %v", err)
+			}
+			if err := <-errChan; err != nil {
+				t.Fatalf("Failed to send payload: %v", err)
+			}
+			if !bytes.Equal(received, tc.data) {
+				t.Errorf("Received payload doesn't match original")
+			}
+		})
+	}
+}
+
+func TestHandshakeRejectsWrongType(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go receivePayload(server, typeFile, key, Options{}, logger)
+
+	_, err := sendPayload(client, typeMessage, []byte("hello"), key, Options{}, logger)
+	if err == nil {
+		t.Fatal("Expected message sent to file receiver to be rejected")
+	}
+}
+
+func TestHandshakeAuthorizedPeers(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+	peersFile := filepath.Join(t.TempDir(), "authorized_peers")
+
+	sender, _ := identity.Generate()
+	receiver, _ := identity.Generate()
+	stranger, _ := identity.Generate()
+
+	receiverOpts := Options{Identity: receiver, AuthorizedPeers: peersFile}
+	if err := identity.AddPeer(peersFile, identity.Peer{Name: "sender", PublicKey: sender.PublicKey()}); err != nil {
+		t.Fatalf("Failed to authorize sender: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		sender   *identity.Identity
+		expectOK bool
+	}{
+		{"Authorized sender", sender, true},
+		{"Unknown sender", stranger, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			errChan := make(chan error, 1)
+			go func() {
+				_, _, err := receivePayload(server, typeFile, key, receiverOpts, logger)
+				errChan <- err
+			}()
+
+			// The list does not name the receiver, which a sender must not require
+			senderOpts := Options{Identity: tc.sender, AuthorizedPeers: peersFile}
+			_, err := sendPayload(client, typeFile, []byte("hello"), key, senderOpts, logger)
+			if tc.expectOK && err != nil {
+				t.Fatalf("Failed to send: %v", err)
+			}
+			if !tc.expectOK && !errors.Is(err, ErrAuthFailed) {
+				t.Fatalf("Unknown sender got %v, want ErrAuthFailed", err)
+			}
+			if err := <-errChan; (err == nil) != tc.expectOK {
+				t.Errorf("Receiver error = %v, expectOK %v", err, tc.expectOK)
+			}
+		})
+	}
+
+	// Removing the last peer opens the receiver again
+	if err := identity.RemovePeer(peersFile, "sender"); err != nil {
+		t.Fatalf("Failed to remove sender: %v", err)
+	}
+	if _, err := receiverOpts.authorizePeer(stranger.PublicKey()); err != nil {
+		t.Errorf("Receiver without peers refused a sender: %v", err)
+	}
+}
+
+func TestReceiverFingerprint(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+	receiver, _ := identity.Generate()
+	impostor, _ := identity.Generate()
+
+	for _, tc := range []struct {
+		name     string
+		identity *identity.Identity
+		expectOK bool
+	}{
+		{"Expected receiver", receiver, true},
+		{"Other receiver", impostor, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go receivePayload(server, typeFile, key, Options{Identity: tc.identity}, logger)
+
+			opts := Options{ReceiverFingerprint: identity.Fingerprint(receiver.PublicKey())}
+			_, err := sendPayload(client, typeFile, []byte("hello"), key, opts, logger)
+			if tc.expectOK && err != nil {
+				t.Fatalf("Failed to send: %v", err)
+			}
+			if !tc.expectOK && !errors.Is(err, ErrAuthFailed) {
+				t.Errorf("Send to the wrong receiver returned %v, want ErrAuthFailed", err)
+			}
+		})
+	}
+}
+
+func TestKnownReceiversPinnedOnFirstUse(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+	receiver, _ := identity.Generate()
+	impostor, _ := identity.Generate()
+	known := filepath.Join(t.TempDir(), "known_receivers")
+	opts := Options{KnownReceivers: known, receiverAddress: "laptop:8080"}
+
+	send := func(receiverIdentity *identity.Identity) (session, error) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		go receivePayload(server, typeFile, key, Options{Identity: receiverIdentity}, logger)
+		return sendPayload(client, typeFile, []byte("hello"), key, opts, logger)
+	}
+
+	if sess, err := send(receiver); err != nil || sess.receiverTrust != trustFirstUse {
+		t.Fatalf("First send: trust %v, %v", sess.receiverTrust, err)
+	}
+	if sess, err := send(receiver); err != nil || sess.receiverTrust != trustPinned {
+		t.Errorf("Second send: trust %v, %v", sess.receiverTrust, err)
+	}
+	if _, err := send(impostor); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Send to a changed identity returned %v, want ErrAuthFailed", err)
+	}
+
+	// Without a pin source nothing is verified
+	opts = Options{}
+	if sess, err := send(impostor); err != nil || sess.receiverTrust != trustNone {
+		t.Errorf("Unpinned send: trust %v, %v", sess.receiverTrust, err)
+	}
+}
+
+func TestSightedPeers(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+	sender, _ := identity.Generate()
+	receiver, _ := identity.Generate()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	type sighting struct{ address, fingerprint string }
+	seen := make(chan sighting, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		receivePayload(conn, typeMessage, key, Options{
+			Identity: receiver,
+			Sighted:  func(address, fingerprint string) { seen <- sighting{address, fingerprint} },
+		}, logger)
+	}()
+
+	var sent sighting
+	address := listener.Addr().String()
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	_, err = sendPayload(conn, typeMessage, []byte("hello"), key, Options{
+		Identity:        sender,
+		Sighted:         func(address, fingerprint string) { sent = sighting{address, fingerprint} },
+		receiverAddress: address,
+	}, logger)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if want := (sighting{address, identity.Fingerprint(receiver.PublicKey())}); sent != want {
+		t.Errorf("Sender saw %+v, want %+v", sent, want)
+	}
+	if got, want := <-seen, (sighting{"127.0.0.1", identity.Fingerprint(sender.PublicKey())}); got != want {
+		t.Errorf("Receiver saw %+v, want %+v", got, want)
+	}
+}
+
+func TestRetiredKeyAccepted(t *testing.T) {
+	logger := testLogger(t)
+	oldKey, _ := crypto.GenerateKey()
+	newKey, _ := crypto.GenerateKey()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go sendPayload(client, typeFile, []byte("sent with the old key"), oldKey, Options{}, logger)
+
+	data, sess, err := receivePayload(server, typeFile, newKey, Options{PreviousKeys: [][]byte{oldKey}}, logger)
+	if err != nil {
+		t.Fatalf("Failed to receive with retired key: %v", err)
+	}
+	if string(data) != "sent with the old key" {
+		t.Errorf("Received %q", data)
+	}
+	if !bytes.Equal(sess.key, oldKey) {
+		t.Error("Session should record the retired key the sender used")
+	}
+}
+
+func TestPassphraseDerivedKey(t *testing.T) {
+	logger := testLogger(t)
+	kdf := crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+
+	testCases := []struct {
+		name     string
+		sender   string
+		receiver string
+		expectOK bool
+	}{
+		{"Same passphrase", "correct horse battery staple", "correct horse battery staple", true},
+		{"Different passphrase", "correct horse battery staple", "tr0ub4dor&3", false},
+		{"Receiver without passphrase", "correct horse battery staple", "", false},
+		{"Sender without passphrase", "", "correct horse battery staple", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			// Neither side holds a shared key
+			go func() {
+				sendPayload(client, typeFile, []byte("derived"), nil, Options{Passphrase: tc.sender, KDF: kdf}, logger)
+				client.Close()
+			}()
+
+			data, sess, err := receivePayload(server, typeFile, nil, Options{Passphrase: tc.receiver, KDF: kdf}, logger)
+			if !tc.expectOK {
+				if err == nil {
+					t.Fatal("Expected transfer to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to receive: %v", err)
+			}
+			if string(data) != "derived" {
+				t.Errorf("Received %q", data)
+			}
+			if len(sess.key) != crypto.KeySize {
+				t.Errorf("Derived key is %d bytes", len(sess.key))
+			}
+		})
+	}
+}
+
+func TestPassphraseCostNotWeakened(t *testing.T) {
+	logger := testLogger(t)
+	passphrase := "correct horse battery staple"
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	weak := crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := sendPayload(client, typeFile, []byte("derived"), nil, Options{Passphrase: passphrase, KDF: weak}, logger)
+		errChan <- err
+	}()
+
+	receiverKDF := crypto.KDFParams{Time: 2, Memory: 8 * 1024, Threads: 1}
+	if _, _, err := receivePayload(server, typeFile, nil, Options{Passphrase: passphrase, KDF: receiverKDF}, logger); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Receiver accepted a weaker derivation: %v", err)
+	}
+	if err := <-errChan; !errors.Is(err, ErrProtocol) {
+		t.Errorf("Sender got %v, want ErrProtocol", err)
+	}
+}
+
+func TestConcurrentDerivationsBounded(t *testing.T) {
+	logger := testLogger(t)
+	var running, peak atomic.Int32
+	deriveKey = func(passphrase string, salt []byte, params crypto.KDFParams) ([]byte, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return crypto.DeriveKey(passphrase, salt, params)
+	}
+	defer func() { deriveKey = crypto.DeriveKey }()
+
+	kdf := crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+	opts := Options{Passphrase: "correct horse battery staple", KDF: kdf}
+	var wg sync.WaitGroup
+	for range 3 * maxDerivations {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		go sendPayload(client, typeFile, []byte("derived"), nil, opts, logger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := receivePayload(server, typeFile, nil, opts, logger); err != nil {
+				t.Errorf("Failed to receive: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got > maxDerivations {
+		t.Errorf("%d derivations ran at once, want at most %d", got, maxDerivations)
+	}
+}
+
+func TestKeyDerivedOnlyForAuthenticatedSender(t *testing.T) {
+	var derivations atomic.Int32
+	deriveKey = func(passphrase string, salt []byte, params crypto.KDFParams) ([]byte, error) {
+		derivations.Add(1)
+		return crypto.DeriveKey(passphrase, salt, params)
+	}
+	defer func() { deriveKey = crypto.DeriveKey }()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	kdf := crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := serverHandshake(server, typeFile, Options{Passphrase: "secret", KDF: kdf})
+		errChan <- err
+	}()
+
+	// A hello announcing an identity whose key the sender does not hold
+	salt, _ := crypto.NewSalt()
+	claimed, _ := identity.Generate()
+	writeJSON(client, clientHello{
+		Version:     protocolVersion,
+		Type:        typeFile,
+		Compression: []string{"none"},
+		Identity:    identity.FormatPublicKey(claimed.PublicKey()),
+		Nonce:       make([]byte, nonceSize),
+		Timestamp:   time.Now(),
+		KDF:         &kdfHeader{Salt: salt, Params: kdf},
+	})
+	var reply serverHello
+	if err := readJSON(client, &reply); err != nil || reply.Error != "" {
+		t.Fatalf("Handshake reply %+v, %v", reply, err)
+	}
+	writeJSON(client, clientAuth{Signature: make([]byte, 64)})
+	readJSON(client, &handshakeResult{})
+
+	if err := <-errChan; !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Forged signature got %v, want ErrAuthFailed", err)
+	}
+	if n := derivations.Load(); n != 0 {
+		t.Errorf("Key derived %d times for an unauthenticated sender", n)
+	}
+}
+
+// logRecords decodes the records written by a JSON handler
+func logRecords(t *testing.T, buf *bytes.Buffer) map[string]map[string]any {
+	t.Helper()
+	records := make(map[string]map[string]any)
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("Malformed log record: %v", err)
+		}
+		records[record["msg"].(string)] = record
+	}
+	return records
+}
+
+func TestSendMessageContextCancelsExchange(t *testing.T) {
+	logger := testLogger(t)
+	_, key := setupTestServerClient(t)
+
+	// A receiver that accepts and then never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	port := listener.Addr().(*net.TCPAddr).Port
+	done := make(chan error, 1)
+	go func() { done <- SendMessageContext(ctx, "127.0.0.1", port, "", "hello", key, Options{}, logger) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("SendMessageContext returned %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SendMessageContext kept waiting after its context ended")
+	}
+}
+
+func TestLogAttributes(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	var serverLog, clientLog bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		handleEchoConnection(conn, key, Options{Clipboard: ClipboardNever}, slog.New(slog.NewJSONHandler(&serverLog, nil)))
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := SendMessage("127.0.0.1", port, "", "hello", key, Options{}, slog.New(slog.NewJSONHandler(&clientLog, nil))); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	<-done
+
+	sent := logRecords(t, &clientLog)
+	received := logRecords(t, &serverLog)
+
+	for _, record := range []map[string]any{sent["Message sent"], sent["Response received"], received["Received message"], received["Sent response to client"]} {
+		if record == nil {
+			t.Fatal("Expected log record missing")
+		}
+		for _, attr := range []string{"peer", "session_id"} {
+			if record[attr] == nil || record[attr] == "" {
+				t.Errorf("Record %q lacks %s", record["msg"], attr)
+			}
+		}
+	}
+	if sent["Message sent"]["session_id"] != received["Received message"]["session_id"] {
+		t.Error("Sender and receiver logged different session IDs")
+	}
+	if sent["Message sent"]["bytes"] != float64(5) || received["Received message"]["bytes"] != float64(5) {
+		t.Error("Both sides should log the payload size as bytes")
+	}
+	if sent["Response received"]["duration"] == nil || received["Sent response to client"]["duration"] == nil {
+		t.Error("Completion records should carry a duration")
+	}
+}
+
+func TestAuditLogRecordsReceipts(t *testing.T) {
+	logger := testLogger(t)
+	_, key := setupTestServerClient(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := audit.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		handleEchoConnection(conn, key, Options{Audit: log, Clipboard: ClipboardNever}, logger)
+	}()
+
+	sender, _ := identity.Generate()
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := SendMessage("127.0.0.1", port, "", "audited", key, Options{Identity: sender}, logger); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	<-done
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Audit log not written: %v", err)
+	}
+	var entry audit.Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("Malformed audit entry: %v", err)
+	}
+	if entry.SHA256 != audit.ContentHash([]byte("audited")) || entry.Size != 7 {
+		t.Errorf("Entry does not describe the content: %+v", entry)
+	}
+	if entry.Fingerprint != identity.Fingerprint(sender.PublicKey()) {
+		t.Errorf("Entry fingerprint = %s, want the sender's", entry.Fingerprint)
+	}
+	if entry.Type != typeMessage || len(entry.Actions) != 0 {
+		t.Errorf("Unexpected type or actions: %+v", entry)
+	}
+	if count, _, err := audit.Verify(bytes.NewReader(data)); err != nil || count != 1 {
+		t.Errorf("Verify = %d, %v", count, err)
+	}
+}
+
+func TestNotifyOnReceipt(t *testing.T) {
+	logger := testLogger(t)
+	key, _ := crypto.GenerateKey()
+	sender, _ := identity.Generate()
+	recorder := &notify.Recorder{}
+	opts := Options{Clipboard: ClipboardNever, Notifier: recorder, NotifyPreview: true}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		handleEchoConnection(conn, key, opts, logger)
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := SendMessage("127.0.0.1", port, "", "hello\nthere", key, Options{Identity: sender}, logger); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	<-done
+
+	saveAs := filepath.Join(t.TempDir(), "received.txt")
+	source := filepath.Join(t.TempDir(), "source.txt")
+	os.WriteFile(source, []byte("file content"), 0644)
+	received := make(chan error, 1)
+	opts.NotifyPreview = false
+	go func() { received <- ReceiveFileFrom(listener, saveAs, key, opts, logger) }()
+	if err := SendFile("127.0.0.1", port, source, key, Options{Identity: sender}, logger); err != nil {
+		t.Fatalf("Failed to send file: %v", err)
+	}
+	if err := <-received; err != nil {
+		t.Fatalf("Failed to receive file: %v", err)
+	}
+
+	fingerprint := identity.Fingerprint(sender.PublicKey())
+	want := []notify.Notification{
+		{Sender: fingerprint, Type: typeMessage, Size: 11, Preview: "hello there"},
+		{Sender: fingerprint, Type: typeFile, Size: 12, Path: saveAs},
+	}
+	if got := recorder.Notifications(); !slices.Equal(got, want) {
+		t.Errorf("Notifications = %+v, want %+v", got, want)
+	}
+}
+
+// blockingNotifier holds every notification until released
+type blockingNotifier struct {
+	release chan struct{}
+}
+
+func (n blockingNotifier) Notify(notify.Notification) error {
+	<-n.release
+	return nil
+}
+
+func TestSlowNotifierDoesNotDelayResponse(t *testing.T) {
+	logger := testLogger(t)
+	key, _ := crypto.GenerateKey()
+	notifier := blockingNotifier{release: make(chan struct{})}
+	defer close(notifier.release)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go ServeEcho(listener, key, Options{Clipboard: ClipboardNever, Notifier: notifier}, logger)
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	sent := make(chan error, 1)
+	go func() { sent <- SendMessage("127.0.0.1", port, "", "hello", key, Options{}, logger) }()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sender waited for the notification")
+	}
+}
@@ -0,0 +1,246 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport names accepted by --transport
+const (
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+)
+
+// Transport establishes the connections transfers run over. The application
+// framing is the same whatever the transport.
+type Transport interface {
+	Listen(address string) (net.Listener, error)
+	Dial(ctx context.Context, address string) (net.Conn, error)
+
+	// Wrap serves the transport on an already open TCP listener, such as
+	// a socket inherited from the service manager
+	Wrap(listener net.Listener) net.Listener
+}
+
+// TCPTransport carries frames over plain TCP
+type TCPTransport struct{}
+
+// Listen listens on a TCP address
+func (TCPTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
+
+// Wrap returns listener unchanged
+func (TCPTransport) Wrap(listener net.Listener) net.Listener {
+	return listener
+}
+
+// Dial connects to a TCP address, giving up when ctx is done
+func (TCPTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// TLSTransport wraps connections in TLS 1.3 using a self-generated
+// certificate. Receivers are trusted on first use and their certificate
+// fingerprint is pinned in the known peers file.
+type TLSTransport struct {
+	certificate    tls.Certificate
+	knownPeersFile string
+	logger         *slog.Logger
+	mu             sync.Mutex
+}
+
+// NewTLSTransport loads the certificate in dir, generating one if needed
+func NewTLSTransport(dir string, logger *slog.Logger) (*TLSTransport, error) {
+	cert, err := loadOrCreateCertificate(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	return &TLSTransport{
+		certificate:    cert,
+		knownPeersFile: filepath.Join(dir, "known_peers"),
+		logger:         logger,
+	}, nil
+}
+
+// Fingerprint returns the pin of the local certificate
+func (t *TLSTransport) Fingerprint() string {
+	return fingerprint(t.certificate.Certificate[0])
+}
+
+// Listen listens on a TCP address and serves TLS 1.3
+func (t *TLSTransport) Listen(address string) (net.Listener, error) {
+	return tls.Listen("tcp", address, t.serverConfig())
+}
+
+// Wrap serves TLS 1.3 on listener
+func (t *TLSTransport) Wrap(listener net.Listener) net.Listener {
+	return tls.NewListener(listener, t.serverConfig())
+}
+
+// serverConfig presents the local certificate to senders
+func (t *TLSTransport) serverConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{t.certificate},
+		MinVersion:   tls.VersionTLS13,
+	}
+}
+
+// Dial connects to address and checks the receiver against its pinned
+// fingerprint, giving up when ctx is done
+func (t *TLSTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		// The self-signed certificate is verified by pinning below
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("receiver presented no certificate")
+			}
+			if err := t.verifyPeer(address, fingerprint(rawCerts[0])); err != nil {
+				return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+			}
+			return nil
+		},
+	}
+	dialer := tls.Dialer{Config: config}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// verifyPeer compares a fingerprint with the pinned one, pinning it on first use
+func (t *TLSTransport) verifyPeer(address, fp string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pinned, err := readKnownPeers(t.knownPeersFile)
+	if err != nil {
+		return fmt.Errorf("error reading known peers: %w", err)
+	}
+	if known, ok := pinned[address]; ok {
+		if known != fp {
+			return fmt.Errorf("certificate for %s changed: pinned %s, got %s (remove the entry from %s if this is expected)",
+				address, known, fp, t.knownPeersFile)
+		}
+		return nil
+	}
+
+	t.logger.Warn("Trusting new peer on first use", "peer", address, "fingerprint", fp)
+	return appendKnownPeer(t.knownPeersFile, address, fp)
+}
+
+// fingerprint returns the SHA-256 pin of a DER certificate
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// readKnownPeers parses "address fingerprint" lines
+func readKnownPeers(path string) (map[string]string, error) {
+	pinned := make(map[string]string)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pinned, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed known peers line %q", line)
+		}
+		pinned[fields[0]] = fields[1]
+	}
+	return pinned, scanner.Err()
+}
+
+// appendKnownPeer pins a fingerprint for address
+func appendKnownPeer(path, address, fp string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s %s\n", address, fp)
+	return err
+}
+
+// loadOrCreateCertificate loads a key pair, generating a self-signed one if missing
+func loadOrCreateCertificate(certFile, keyFile string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		return cert, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return tls.Certificate{}, err
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "secure-transfer " + hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
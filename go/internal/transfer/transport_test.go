@@ -0,0 +1,120 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveOnce accepts one connection on listener and receives a file payload
+func serveOnce(listener net.Listener, key []byte, logger *slog.Logger) <-chan []byte {
+	received := make(chan []byte, 1)
+	go func() {
+		defer close(received)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _, err := receivePayload(conn, typeFile, key, Options{}, logger)
+		if err == nil {
+			received <- data
+		}
+	}()
+	return received
+}
+
+func TestTLSTransportPinsOnFirstUse(t *testing.T) {
+	_, key := setupTestServerClient(t)
+	logger := testLogger(t)
+
+	client, err := NewTLSTransport(t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("Failed to create client transport: %v", err)
+	}
+	server, err := NewTLSTransport(t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("Failed to create server transport: %v", err)
+	}
+
+	listener, err := server.Listen("localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	received := serveOnce(listener, key, logger)
+
+	conn, err := client.Dial(context.Background(), address)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	payload := []byte("pinned payload")
+	if _, err := sendPayload(conn, typeFile, payload, key, Options{}, logger); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	conn.Close()
+	if got := <-received; !bytes.Equal(got, payload) {
+		t.Errorf("Received %q, want %q", got, payload)
+	}
+	listener.Close()
+
+	knownPeers, err := os.ReadFile(client.knownPeersFile)
+	if err != nil {
+		t.Fatalf("Known peers file not written: %v", err)
+	}
+	if !strings.Contains(string(knownPeers), address+" "+server.Fingerprint()) {
+		t.Errorf("Known peers file doesn't pin the receiver: %q", knownPeers)
+	}
+
+	// A different certificate on the same address must be refused
+	impostor, err := NewTLSTransport(t.TempDir(), logger)
+	if err != nil {
+		t.Fatalf("Failed to create impostor transport: %v", err)
+	}
+	listener, err = impostor.Listen(address)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	serveOnce(listener, key, logger)
+
+	conn, err = client.Dial(context.Background(), address)
+	if err == nil {
+		conn.Close()
+		t.Fatal("Expected dial to a changed certificate to fail")
+	}
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("Changed certificate error %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestTLSTransportReusesCertificate(t *testing.T) {
+	dir := t.TempDir()
+	logger := testLogger(t)
+
+	first, err := NewTLSTransport(dir, logger)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+	second, err := NewTLSTransport(dir, logger)
+	if err != nil {
+		t.Fatalf("Failed to reload transport: %v", err)
+	}
+	if first.Fingerprint() != second.Fingerprint() {
+		t.Error("Certificate was regenerated instead of reused")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatalf("Key file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Key file permissions = %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -21,8 +21,14 @@ THE SOFTWARE.
 */
 package main
 
-import "secure-transfer/cmd"
+import (
+	"os"
+
+	"secure-transfer/cmd"
+)
 
 func main() {
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(cmd.ExitCode(err))
+	}
 }
@@ -0,0 +1,432 @@
+// Package securetransfer sends and receives files and messages encrypted
+// with a shared key or passphrase, as the secure-transfer command does.
+//
+// A Client sends to a Server. Files are received one at a time with
+// Server.ReceiveFile; messages are received continuously with
+// Server.ServeMessages, which answers each sender with an acknowledgement.
+//
+// This package is the stable API for embedding transfers in other programs.
+// Packages under internal/ may change without notice.
+package securetransfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"secure-transfer/internal/audit"
+	"secure-transfer/internal/compress"
+	"secure-transfer/internal/crypto"
+	"secure-transfer/internal/identity"
+	"secure-transfer/internal/transfer"
+)
+
+// Cipher suites for the Cipher options
+const (
+	CipherAES256GCM         = crypto.CipherAES256GCM
+	CipherXChaCha20Poly1305 = crypto.CipherXChaCha20Poly1305
+)
+
+// Compression modes for ClientOptions.Compression
+const (
+	CompressAuto = compress.Auto
+	CompressZstd = compress.Zstd
+	CompressGzip = compress.Gzip
+	CompressNone = compress.None
+)
+
+// Clipboard policies for ServerOptions.Clipboard
+const (
+	ClipboardAuto   = transfer.ClipboardAuto
+	ClipboardAlways = transfer.ClipboardAlways
+	ClipboardNever  = transfer.ClipboardNever
+)
+
+// KeySize is the length of a shared key in bytes
+const KeySize = crypto.KeySize
+
+// ErrNoKey is returned by NewClient and NewServer when neither a key nor a
+// passphrase is configured
+var ErrNoKey = errors.New("securetransfer: a key or passphrase is required")
+
+// Failure categories of transfers, to be tested with errors.Is
+var (
+	// ErrAuthFailed means the peer failed to prove its identity or is not
+	// an authorized peer
+	ErrAuthFailed = transfer.ErrAuthFailed
+
+	// ErrProtocol means the peers could not agree on how to transfer,
+	// such as the protocol version, cipher or passphrase settings
+	ErrProtocol = transfer.ErrProtocol
+
+	// ErrReplayed means the server refused the transfer as a replay,
+	// which for a genuine client usually means the clocks disagree
+	ErrReplayed = transfer.ErrReplayed
+
+	// ErrPeerUnreachable means no connection to the peer could be made
+	ErrPeerUnreachable = transfer.ErrPeerUnreachable
+
+	// ErrIntegrity means received data failed to decrypt or authenticate,
+	// usually because of a wrong key or tampering in transit
+	ErrIntegrity = transfer.ErrIntegrity
+
+	// ErrTooLarge means a payload exceeds what the receiver accepts
+	ErrTooLarge = transfer.ErrTooLarge
+
+	// ErrRejected means the server declined the item when asked to
+	// approve it
+	ErrRejected = transfer.ErrRejected
+
+	// ErrClipboardUnavailable means received content could not be copied
+	// to the clipboard; Server.ReceiveFile only returns it with
+	// ClipboardAlways
+	ErrClipboardUnavailable = transfer.ErrClipboardUnavailable
+)
+
+// OptionsError reports an invalid field of ClientOptions or ServerOptions
+type OptionsError struct {
+	Field string
+	Err   error
+}
+
+func (e *OptionsError) Error() string {
+	return fmt.Sprintf("securetransfer: invalid %s: %v", e.Field, e.Err)
+}
+
+func (e *OptionsError) Unwrap() error {
+	return e.Err
+}
+
+// GenerateKey returns a new random shared key
+func GenerateKey() ([]byte, error) {
+	return crypto.GenerateKey()
+}
+
+// ParseKey decodes a key in any encoding TRANSFER_KEY accepts: hex,
+// base64, URL-safe base64 or the base32 groups printed by `key export`
+func ParseKey(text string) ([]byte, error) {
+	return crypto.ImportKey(text)
+}
+
+// KDFParams are the Argon2id costs of deriving a key from a passphrase
+type KDFParams struct {
+	// Time is the number of passes over memory
+	Time uint32
+
+	// Memory is the memory cost in KiB
+	Memory uint32
+
+	// Threads is the degree of parallelism
+	Threads uint8
+}
+
+// DefaultKDFParams are the costs used when Common.KDF is zero
+var DefaultKDFParams = KDFParams(crypto.DefaultKDFParams)
+
+// Common holds the options shared by clients and servers
+type Common struct {
+	// Key is the shared key of KeySize bytes. Either Key or Passphrase
+	// is required.
+	Key []byte
+
+	// Passphrase derives a fresh key for each transfer with Argon2id
+	// instead of using Key
+	Passphrase string
+
+	// KDF are the passphrase derivation costs. Clients derive with them
+	// and servers refuse senders deriving with less. DefaultKDFParams
+	// when zero.
+	KDF KDFParams
+
+	// IdentityFile is the PEM file holding this side's Ed25519 identity,
+	// created if missing. An ephemeral identity is used when empty.
+	IdentityFile string
+
+	// Cipher restricts the cipher suite; any supported suite is
+	// negotiated when empty
+	Cipher string
+
+	// TLSDir enables the TLS transport, keeping its certificate and
+	// pinned peer certificates in this directory. Plain TCP when empty.
+	TLSDir string
+
+	// Logger receives progress and diagnostics; discarded when nil
+	Logger *slog.Logger
+}
+
+// options converts the common options to transfer options
+func (c Common) options() (transfer.Options, *slog.Logger, error) {
+	logger := c.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	var opts transfer.Options
+
+	if len(c.Key) == 0 && c.Passphrase == "" {
+		return opts, logger, ErrNoKey
+	}
+	if len(c.Key) != 0 && len(c.Key) != KeySize {
+		return opts, logger, &OptionsError{Field: "Key", Err: fmt.Errorf("key is %d bytes, want %d", len(c.Key), KeySize)}
+	}
+	opts.Passphrase = c.Passphrase
+	if c.KDF != (KDFParams{}) {
+		kdf := crypto.KDFParams(c.KDF)
+		if err := kdf.Validate(); err != nil {
+			return opts, logger, &OptionsError{Field: "KDF", Err: err}
+		}
+		opts.KDF = kdf
+	}
+
+	if c.Cipher != "" {
+		if _, err := crypto.CipherByName(c.Cipher); err != nil {
+			return opts, logger, &OptionsError{Field: "Cipher", Err: err}
+		}
+		opts.Cipher = c.Cipher
+	}
+
+	if c.IdentityFile != "" {
+		self, err := identity.LoadOrCreate(c.IdentityFile)
+		if err != nil {
+			return opts, logger, &OptionsError{Field: "IdentityFile", Err: err}
+		}
+		opts.Identity = self
+	}
+
+	if c.TLSDir != "" {
+		tlsTransport, err := transfer.NewTLSTransport(c.TLSDir, logger)
+		if err != nil {
+			return opts, logger, &OptionsError{Field: "TLSDir", Err: err}
+		}
+		opts.Transport = tlsTransport
+	} else {
+		opts.Transport = transfer.TCPTransport{}
+	}
+	return opts, logger, nil
+}
+
+// ClientOptions configure a Client
+type ClientOptions struct {
+	Common
+
+	// Compression is applied before encryption: CompressAuto (the
+	// default), CompressZstd, CompressGzip or CompressNone
+	Compression string
+
+	// Retry controls connection attempts; one attempt when zero
+	Retry Retry
+}
+
+// Retry controls how a client connects to servers. Delays start at
+// Backoff and double up to MaxBackoff, with random jitter.
+type Retry struct {
+	// ConnectTimeout bounds each connection attempt
+	ConnectTimeout time.Duration
+
+	// Retries is the number of attempts made after the first one fails
+	Retries int
+
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Wait retries until the server is reachable or ctx is cancelled
+	Wait bool
+}
+
+// Client sends files and messages
+type Client struct {
+	key    []byte
+	opts   transfer.Options
+	logger *slog.Logger
+}
+
+// NewClient validates opts and returns a client
+func NewClient(opts ClientOptions) (*Client, error) {
+	transferOpts, logger, err := opts.options()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Compression != "" {
+		if _, err := compress.ParseMode(opts.Compression); err != nil {
+			return nil, &OptionsError{Field: "Compression", Err: err}
+		}
+	}
+	transferOpts.Compression = opts.Compression
+	transferOpts.Retry = transfer.Retry(opts.Retry)
+	return &Client{key: opts.Key, opts: transferOpts, logger: logger}, nil
+}
+
+// SendFile sends the file at path to a server receiving at address
+// (host:port). Cancelling ctx aborts the transfer.
+func (c *Client) SendFile(ctx context.Context, address, path string) error {
+	host, port, err := splitAddress(address)
+	if err != nil {
+		return err
+	}
+	return transfer.SendFileContext(ctx, host, port, path, c.key, c.opts, c.logger)
+}
+
+// SendMessage sends message to a server serving messages at address
+// (host:port) and waits for its acknowledgement. Cancelling ctx aborts
+// the transfer.
+func (c *Client) SendMessage(ctx context.Context, address, message string) error {
+	host, port, err := splitAddress(address)
+	if err != nil {
+		return err
+	}
+	return transfer.SendMessageContext(ctx, host, port, "", message, c.key, c.opts, c.logger)
+}
+
+// Limits protect a server from misbehaving senders. Zero values disable
+// the corresponding limit.
+type Limits struct {
+	MaxConnections int
+	RatePerIP      float64
+	Burst          int
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	MaxPayload     int
+}
+
+// ServerOptions configure a Server
+type ServerOptions struct {
+	Common
+
+	// PreviousKeys are retired keys still accepted from senders
+	PreviousKeys [][]byte
+
+	// AuthorizedPeersFile lists the sender identities accepted, one
+	// "ed25519 <base64> <name>" line each. Any sender holding the key is
+	// accepted when empty or when the file does not exist.
+	AuthorizedPeersFile string
+
+	// Allow and Deny are CIDR ranges or addresses senders may or may not
+	// connect from
+	Allow, Deny []string
+
+	// Clipboard decides whether received content is copied to the
+	// clipboard: ClipboardNever (the default), ClipboardAuto or
+	// ClipboardAlways
+	Clipboard string
+
+	// ReplayWindow, when set, rejects messages whose timestamp is further
+	// than this from the local clock or that were already received
+	ReplayWindow time.Duration
+
+	// ReplayCache is the number of message nonces remembered; 10000 when zero
+	ReplayCache int
+
+	// AuditLog, when set, is the hash-chained log received items are
+	// recorded in
+	AuditLog string
+
+	Limits Limits
+}
+
+// Server receives files and messages
+type Server struct {
+	key    []byte
+	opts   transfer.Options
+	logger *slog.Logger
+}
+
+// NewServer validates opts and returns a server
+func NewServer(opts ServerOptions) (*Server, error) {
+	transferOpts, logger, err := opts.options()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range opts.PreviousKeys {
+		if len(key) != KeySize {
+			return nil, &OptionsError{Field: "PreviousKeys", Err: fmt.Errorf("key is %d bytes, want %d", len(key), KeySize)}
+		}
+	}
+	transferOpts.PreviousKeys = opts.PreviousKeys
+	transferOpts.AuthorizedPeers = opts.AuthorizedPeersFile
+
+	if transferOpts.Access, err = transfer.ParseAccessList(opts.Allow, opts.Deny); err != nil {
+		return nil, &OptionsError{Field: "Allow/Deny", Err: err}
+	}
+	// Unlike the command, a library only touches the clipboard when asked
+	transferOpts.Clipboard = ClipboardNever
+	if opts.Clipboard != "" {
+		if err := transfer.ValidateClipboardPolicy(opts.Clipboard); err != nil {
+			return nil, &OptionsError{Field: "Clipboard", Err: err}
+		}
+		transferOpts.Clipboard = opts.Clipboard
+	}
+
+	if opts.ReplayWindow > 0 {
+		capacity := opts.ReplayCache
+		if capacity <= 0 {
+			capacity = 10000
+		}
+		transferOpts.Replay = transfer.NewReplayGuard(opts.ReplayWindow, capacity)
+	}
+	if opts.AuditLog != "" {
+		if transferOpts.Audit, err = audit.Open(opts.AuditLog); err != nil {
+			return nil, &OptionsError{Field: "AuditLog", Err: err}
+		}
+		if dropped := transferOpts.Audit.Dropped(); dropped > 0 {
+			logger.Warn("Removed an interrupted entry from the end of the audit log", "file", opts.AuditLog, "bytes", dropped)
+		}
+	}
+	transferOpts.Limits = transfer.Limits(opts.Limits)
+
+	return &Server{key: opts.Key, opts: transferOpts, logger: logger}, nil
+}
+
+// ReceiveFile listens on address (host:port), receives one file and saves
+// it to path. Cancelling ctx stops waiting for a sender.
+func (s *Server) ReceiveFile(ctx context.Context, address, path string) error {
+	listener, err := s.listen(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	return transfer.ContextError(ctx, transfer.ReceiveFileFrom(listener, path, s.key, s.opts, s.logger))
+}
+
+// ServeMessages listens on address (host:port) and receives messages until
+// ctx is cancelled, when it returns ctx.Err()
+func (s *Server) ServeMessages(ctx context.Context, address string) error {
+	listener, err := s.listen(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	err = transfer.ServeEcho(listener, s.key, s.opts, s.logger)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// listen opens a listener that is closed when ctx is done
+func (s *Server) listen(ctx context.Context, address string) (net.Listener, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	listener, err := s.opts.Transport.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+	context.AfterFunc(ctx, func() { listener.Close() })
+	return listener, nil
+}
+
+// splitAddress parses host:port
+func splitAddress(address string) (string, int, error) {
+	host, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, fmt.Errorf("securetransfer: invalid address %q: %w", address, err)
+	}
+	port, err := net.LookupPort("tcp", portText)
+	if err != nil {
+		return "", 0, fmt.Errorf("securetransfer: invalid address %q: %w", address, err)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,229 @@
+package securetransfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// freeAddress returns a loopback address nothing is listening on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// waitForListener waits until address accepts connections
+func waitForListener(t *testing.T, address string) {
+	t.Helper()
+	for range 50 {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Nothing listening on %s", address)
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	key, _ := GenerateKey()
+	address := freeAddress(t)
+
+	server, err := NewServer(ServerOptions{Common: Common{Key: key}, Clipboard: ClipboardNever})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- server.ServeMessages(ctx, address) }()
+	waitForListener(t, address)
+
+	client, err := NewClient(ClientOptions{Common: Common{Key: key}})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.SendMessage(context.Background(), address, "hello"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ServeMessages returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeMessages did not stop when cancelled")
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	key, _ := GenerateKey()
+	address := freeAddress(t)
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	saved := filepath.Join(dir, "saved.txt")
+	os.WriteFile(source, []byte("file content"), 0600)
+
+	server, err := NewServer(ServerOptions{Common: Common{Key: key}, Clipboard: ClipboardNever})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	received := make(chan error, 1)
+	go func() { received <- server.ReceiveFile(context.Background(), address, saved) }()
+
+	// A probe connection would be taken for the one file, so wait instead
+	client, _ := NewClient(ClientOptions{
+		Common:      Common{Key: key},
+		Compression: CompressZstd,
+		Retry:       Retry{Wait: true, Backoff: 10 * time.Millisecond},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.SendFile(ctx, address, source); err != nil {
+		t.Fatalf("SendFile failed: %v", err)
+	}
+	if err := <-received; err != nil {
+		t.Fatalf("ReceiveFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(saved); string(data) != "file content" {
+		t.Errorf("Saved file contains %q", data)
+	}
+}
+
+func TestReceiveFileCancelled(t *testing.T) {
+	key, _ := GenerateKey()
+	server, _ := NewServer(ServerOptions{Common: Common{Key: key}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := server.ReceiveFile(ctx, freeAddress(t), filepath.Join(t.TempDir(), "never"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReceiveFile returned %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	key, _ := GenerateKey()
+	client, _ := NewClient(ClientOptions{Common: Common{Key: key}, Retry: Retry{Wait: true, Backoff: time.Minute, MaxBackoff: time.Minute}})
+
+	// The deadline falls within the first backoff, which must not run out
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := client.SendMessage(ctx, freeAddress(t), "never delivered")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendMessage returned %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("SendMessage returned after %v, ignoring the cancelled context", elapsed)
+	}
+}
+
+func TestOptionsValidation(t *testing.T) {
+	key, _ := GenerateKey()
+
+	if _, err := NewClient(ClientOptions{}); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Missing key: %v, want ErrNoKey", err)
+	}
+
+	testCases := []struct {
+		name  string
+		err   func() error
+		field string
+	}{
+		{"Short key", func() error {
+			_, err := NewClient(ClientOptions{Common: Common{Key: key[:16]}})
+			return err
+		}, "Key"},
+		{"Unknown cipher", func() error {
+			_, err := NewClient(ClientOptions{Common: Common{Key: key, Cipher: "rot13"}})
+			return err
+		}, "Cipher"},
+		{"Unknown compression", func() error {
+			_, err := NewClient(ClientOptions{Common: Common{Key: key}, Compression: "lzma"})
+			return err
+		}, "Compression"},
+		{"Bad CIDR", func() error {
+			_, err := NewServer(ServerOptions{Common: Common{Key: key}, Allow: []string{"10.0.0.0/99"}})
+			return err
+		}, "Allow/Deny"},
+		{"Too many KDF threads", func() error {
+			_, err := NewClient(ClientOptions{Common: Common{Passphrase: "correct horse", KDF: KDFParams{Time: 1, Memory: 8 * 1024, Threads: 255}}})
+			return err
+		}, "KDF"},
+		{"Unknown clipboard policy", func() error {
+			_, err := NewServer(ServerOptions{Common: Common{Key: key}, Clipboard: "sometimes"})
+			return err
+		}, "Clipboard"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var optsErr *OptionsError
+			if err := tc.err(); !errors.As(err, &optsErr) || optsErr.Field != tc.field {
+				t.Errorf("Error %v, want OptionsError for %s", err, tc.field)
+			}
+		})
+	}
+}
+
+func TestClipboardOffByDefault(t *testing.T) {
+	key, _ := GenerateKey()
+	server, err := NewServer(ServerOptions{Common: Common{Key: key}})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	if server.opts.Clipboard != ClipboardNever {
+		t.Errorf("Default clipboard policy = %q, want %q", server.opts.Clipboard, ClipboardNever)
+	}
+}
+
+func TestPassphraseKDF(t *testing.T) {
+	address := freeAddress(t)
+	passphrase := "correct horse battery staple"
+	server, err := NewServer(ServerOptions{
+		Common:    Common{Passphrase: passphrase, KDF: KDFParams{Time: 1, Memory: 16 * 1024, Threads: 1}},
+		Clipboard: ClipboardNever,
+	})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.ServeMessages(ctx, address)
+	waitForListener(t, address)
+
+	send := func(kdf KDFParams) error {
+		client, err := NewClient(ClientOptions{Common: Common{Passphrase: passphrase, KDF: kdf}})
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		return client.SendMessage(context.Background(), address, "hello")
+	}
+	if err := send(KDFParams{Time: 1, Memory: 16 * 1024, Threads: 1}); err != nil {
+		t.Errorf("Send with the server's costs failed: %v", err)
+	}
+	if err := send(KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Send with weaker costs returned %v, want ErrProtocol", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key, _ := GenerateKey()
+	parsed, err := ParseKey("  " + hex.EncodeToString(key) + "\n")
+	if err != nil || !bytes.Equal(parsed, key) {
+		t.Errorf("ParseKey = %x, %v", parsed, err)
+	}
+}
@@ -5,6 +5,10 @@ set -e
 echo "Building application..."
 go build -o secure-transfer
 
+# Use a throwaway configuration and key
+CONFIG_DIR=$(mktemp -d)
+export TRANSFER_KEY=$(head -c 32 /dev/urandom | base64)
+
 # Generate test file
 echo "Creating test file..."
 dd if=/dev/urandom of=test_file.bin bs=1K count=256
@@ -15,15 +19,12 @@ echo "Using port: $PORT"
 
 # Start server in background
 echo "Starting server..."
-./secure-transfer server --port "$PORT" --save received_file.bin &
+./secure-transfer server --config-dir "$CONFIG_DIR" --port "$PORT" --save received_file.bin &
 SERVER_PID=$!
 
-# Give server time to start
-sleep 1
-
-# Send file
+# Send file, waiting for the server to start listening
 echo "Sending file..."
-./secure-transfer client --ip localhost --port "$PORT" --file test_file.bin
+./secure-transfer client --config-dir "$CONFIG_DIR" --ip localhost --port "$PORT" --file test_file.bin --wait
 
 # Give time for completion
 sleep 1
@@ -43,18 +44,26 @@ fi
 
 # Test echo functionality
 echo "Testing echo functionality..."
-./secure-transfer echo --port "$PORT" &
+./secure-transfer echo --config-dir "$CONFIG_DIR" --port "$PORT" &
 ECHO_PID=$!
 
-# Give server time to start
-sleep 1
-
 # Message to send
 TEST_MESSAGE="This is a test message for the echo server functionality"
 
 # Send message
 echo "Sending message..."
-./secure-transfer client --ip localhost --port "$PORT" --message "$TEST_MESSAGE"
+./secure-transfer client --config-dir "$CONFIG_DIR" --ip localhost --port "$PORT" --message "$TEST_MESSAGE" --wait
+
+# Send to several receivers, one of which is not running
+echo "Sending message to several receivers..."
+set +e
+./secure-transfer client --config-dir "$CONFIG_DIR" --to "localhost:$PORT,127.0.0.1:$PORT,localhost:$((PORT + 1))" --retries 0 --message "$TEST_MESSAGE"
+STATUS=$?
+set -e
+if [ "$STATUS" -ne 9 ]; then
+    echo "ERROR: Partial delivery exited with $STATUS, want 9."
+    exit 1
+fi
 
 # Kill echo server
 echo "Stopping echo server..."
@@ -63,5 +72,6 @@ kill $ECHO_PID || true
 # Clean up
 echo "Cleaning up..."
 rm -f test_file.bin received_file.bin secure-transfer
+rm -rf "$CONFIG_DIR"
 
 echo "All tests completed successfully!"